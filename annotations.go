@@ -0,0 +1,155 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// lineRange is a range of consecutive lines
+type lineRange struct {
+	start int
+	end   int
+}
+
+// githubAnnotationsReporter writes GitHub Actions workflow commands that
+// annotate the uncovered lines changed since base, or all the uncovered
+// lines if base is empty
+type githubAnnotationsReporter struct {
+	filename   string
+	base       string
+	maxPerFile int
+}
+
+// uncoveredRanges returns the ranges of consecutive lines in blocks that
+// aren't covered at all.  If changed isn't nil only the lines in it are
+// included.
+func uncoveredRanges(blocks []profileBlock, changed map[int]bool) []lineRange {
+	r := []lineRange{}
+	lines := lineCoverage(blocks)
+	for _, line := range sortedLines(lines) {
+		if lines[line].covered > 0 || (changed != nil && !changed[line]) {
+			continue
+		}
+		if n := len(r); n > 0 && r[n-1].end == line-1 {
+			r[n-1].end = line
+			continue
+		}
+		r = append(r, lineRange{start: line, end: line})
+	}
+	return r
+}
+
+// escapeProperty escapes s for use as a property of a workflow command
+func escapeProperty(s string) string {
+	return strings.NewReplacer(
+		"%", "%25",
+		"\r", "%0D",
+		"\n", "%0A",
+		":", "%3A",
+		",", "%2C",
+	).Replace(s)
+}
+
+// fileRanges is the path of a file along with ranges of lines in it
+type fileRanges struct {
+	path   string
+	ranges []lineRange
+}
+
+// uncoveredFiles returns the ranges of uncovered lines in each file of prof
+// that has any, with the paths of the files relative to baseDir.  If
+// changed isn't nil only changed lines are included.
+func uncoveredFiles(
+	prof *profile,
+	resolver *pathResolver,
+	baseDir string,
+	changed changedLines,
+) ([]fileRanges, error) {
+	r := []fileRanges{}
+	for _, f := range summarize(prof).files {
+		path, err := resolver.relPath(baseDir, f.file)
+		if err != nil {
+			return nil, err
+		}
+		var fileChanged map[int]bool
+		if changed != nil {
+			fileChanged = changed[path]
+			if fileChanged == nil {
+				continue
+			}
+		}
+		ranges := uncoveredRanges(f.blocks, fileChanged)
+		if len(ranges) > 0 {
+			r = append(r, fileRanges{path: path, ranges: ranges})
+		}
+	}
+	return r, nil
+}
+
+// uncoveredChanges returns the ranges of uncovered lines in prof changed
+// since the git ref base, with the paths of the files relative to the top
+// of the git repository.  If base is empty all the uncovered lines are
+// returned.
+func uncoveredChanges(
+	prof *profile,
+	run *runInfo,
+	base string,
+) ([]fileRanges, error) {
+	changed, baseDir, err := changedSince(run, base)
+	if err != nil {
+		return nil, err
+	}
+	return uncoveredFiles(prof, run.resolver, baseDir, changed)
+}
+
+// changedSince returns the lines changed since the git ref base and the
+// directory that their paths are relative to, which is the top of the git
+// repository if there is one.  If base is empty the changed lines are nil.
+func changedSince(run *runInfo, base string) (changedLines, string, error) {
+	if base != "" {
+		return gitChangedLines(base)
+	}
+	if root := gitRoot(); root != "" {
+		return nil, root, nil
+	}
+	return nil, run.wd, nil
+}
+
+// writeGitHubAnnotations writes a warning for each range of lines in
+// files.  At most maxPerFile warnings are written for each file.
+func writeGitHubAnnotations(
+	w io.Writer,
+	files []fileRanges,
+	maxPerFile int,
+) error {
+	for _, f := range files {
+		file := escapeProperty(f.path)
+		for i, lr := range f.ranges {
+			if i == maxPerFile {
+				fmt.Fprintf(w, "::notice file=%s::%d more uncovered ranges not annotated\n",
+					file, len(f.ranges)-maxPerFile)
+				break
+			}
+			_, err := fmt.Fprintf(w, "::warning file=%s,line=%d,endLine=%d::Not covered\n",
+				file, lr.start, lr.end)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r githubAnnotationsReporter) Report(prof *profile, run *runInfo) error {
+	files, err := uncoveredChanges(prof, run, r.base)
+	if err != nil {
+		return err
+	}
+	return writeReportFile(r.filename, run.out, func(w io.Writer) error {
+		return writeGitHubAnnotations(w, files, r.maxPerFile)
+	})
+}
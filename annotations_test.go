@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestUncoveredRanges(t *testing.T) {
+	blocks := []profileBlock{
+		{startLine: 1, startCol: 10, endLine: 3, endCol: 2, numStmt: 2, count: 0},
+		{startLine: 3, startCol: 2, endLine: 5, endCol: 1, numStmt: 1, count: 0},
+		{startLine: 6, startCol: 2, endLine: 6, endCol: 9, numStmt: 1, count: 1},
+		{startLine: 8, startCol: 2, endLine: 9, endCol: 9, numStmt: 1, count: 0},
+	}
+	cases := []struct {
+		changed map[int]bool
+		want    []lineRange
+	}{
+		{want: []lineRange{{1, 4}, {8, 9}}},
+		{changed: map[int]bool{2: true, 3: true, 6: true, 9: true},
+			want: []lineRange{{2, 3}, {9, 9}}},
+		{changed: map[int]bool{}, want: []lineRange{}},
+	}
+	for _, c := range cases {
+		got := uncoveredRanges(blocks, c.changed)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("uncoveredRanges(%v) got: %v, want: %v", c.changed, got, c.want)
+		}
+	}
+}
+
+func TestUncoveredFiles(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "testdata/funcs/funcs.go"
+	prof := &profile{mode: "set", blocks: []profileBlock{
+		{file: file, startLine: 5, startCol: 31, endLine: 6, endCol: 11, numStmt: 1, count: 1},
+		{file: file, startLine: 6, startCol: 11, endLine: 8, endCol: 3, numStmt: 1, count: 0},
+		{file: file, startLine: 9, startCol: 2, endLine: 9, endCol: 10, numStmt: 1, count: 0},
+		{file: file, startLine: 12, startCol: 24, endLine: 14, endCol: 2, numStmt: 1, count: 0},
+	}}
+	cases := []struct {
+		changed changedLines
+		want    []fileRanges
+	}{
+		{want: []fileRanges{{path: file, ranges: []lineRange{{7, 9}, {12, 14}}}}},
+		{changed: changedLines{
+			file:       {8: true, 13: true, 14: true},
+			"other.go": {1: true},
+		},
+			want: []fileRanges{{path: file, ranges: []lineRange{{8, 8}, {13, 14}}}}},
+		{changed: changedLines{file: {5: true}}, want: []fileRanges{}},
+		{changed: changedLines{"other.go": {1: true}}, want: []fileRanges{}},
+	}
+	for _, c := range cases {
+		got, err := uncoveredFiles(prof, newPathResolver(), wd, c.changed)
+		if err != nil {
+			t.Errorf("uncoveredFiles err: %s", err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("uncoveredFiles(%v) got: %v, want: %v", c.changed, got, c.want)
+		}
+	}
+}
+
+func TestWriteGitHubAnnotations(t *testing.T) {
+	files := []fileRanges{
+		{path: "a.go", ranges: []lineRange{{7, 9}, {12, 14}, {16, 18}}},
+		{path: "b,c.go", ranges: []lineRange{{1, 1}}},
+	}
+	cases := []struct {
+		maxPerFile int
+		want       string
+	}{
+		{maxPerFile: 10,
+			want: "::warning file=a.go,line=7,endLine=9::Not covered\n" +
+				"::warning file=a.go,line=12,endLine=14::Not covered\n" +
+				"::warning file=a.go,line=16,endLine=18::Not covered\n" +
+				"::warning file=b%2Cc.go,line=1,endLine=1::Not covered\n"},
+		{maxPerFile: 1,
+			want: "::warning file=a.go,line=7,endLine=9::Not covered\n" +
+				"::notice file=a.go::2 more uncovered ranges not annotated\n" +
+				"::warning file=b%2Cc.go,line=1,endLine=1::Not covered\n"},
+	}
+	for _, c := range cases {
+		var got bytes.Buffer
+		if err := writeGitHubAnnotations(&got, files, c.maxPerFile); err != nil {
+			t.Errorf("writeGitHubAnnotations err: %s", err)
+			continue
+		}
+		if got.String() != c.want {
+			t.Errorf("writeGitHubAnnotations got: %s, want: %s", got.String(), c.want)
+		}
+	}
+}
+
+func TestEscapeProperty(t *testing.T) {
+	got := escapeProperty("a,b:c%d\ne")
+	want := "a%2Cb%3Ac%25d%0Ae"
+	if got != want {
+		t.Errorf("escapeProperty got: %s, want: %s", got, want)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const defaultBadgeColours = "0:red,50:orange,70:yellow,80:green,90:brightgreen"
+
+// badgeColourNames are the named colours that can be used for badges
+var badgeColourNames = map[string]string{
+	"brightgreen": "#4c1",
+	"green":       "#97ca00",
+	"yellowgreen": "#a4a61d",
+	"yellow":      "#dfb317",
+	"orange":      "#fe7d37",
+	"red":         "#e05d44",
+	"blue":        "#007ec6",
+	"grey":        "#555",
+	"lightgrey":   "#9f9f9f",
+}
+
+// badgeThreshold is the colour of a badge whose percentage is at least min
+type badgeThreshold struct {
+	min    float64
+	colour string
+}
+
+// badge is the data passed to the badge template
+type badge struct {
+	Label       string
+	Value       string
+	Colour      string
+	LabelWidth  int
+	ValueWidth  int
+	Width       int
+	LabelCentre float64
+	ValueCentre float64
+}
+
+// badgeReporter writes an SVG badge of the total coverage to filename and,
+// if perPackage is set, a badge for each top-level package
+type badgeReporter struct {
+	filename   string
+	label      string
+	thresholds []badgeThreshold
+	perPackage bool
+}
+
+// parseBadgeColours parses a comma separated list of thresholds of the form
+// min:colour, where colour is a name or a hex colour such as #4c1
+func parseBadgeColours(s string) ([]badgeThreshold, error) {
+	r := []badgeThreshold{}
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(field, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid badge colour: %s", field)
+		}
+		min, err := strconv.ParseFloat(kv[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid badge colour: %s", field)
+		}
+		colour, ok := badgeColourNames[kv[1]]
+		if !ok {
+			if !isHexColour(kv[1]) {
+				return nil, fmt.Errorf("invalid badge colour: %s", field)
+			}
+			colour = kv[1]
+		}
+		r = append(r, badgeThreshold{min: min, colour: colour})
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].min < r[j].min })
+	return r, nil
+}
+
+func isHexColour(s string) bool {
+	if len(s) != 4 && len(s) != 7 || s[0] != '#' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// badgeColour returns the colour of the highest threshold that percent
+// reaches
+func badgeColour(thresholds []badgeThreshold, percent float64) string {
+	colour := badgeColourNames["lightgrey"]
+	for _, t := range thresholds {
+		if percent >= t.min {
+			colour = t.colour
+		}
+	}
+	return colour
+}
+
+// textWidth estimates the width in pixels of s in 11px Verdana
+func textWidth(s string) int {
+	width := 0.0
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("ijlI.,:;|!' ", c):
+			width += 3.5
+		case strings.ContainsRune("mwMW%", c):
+			width += 10
+		case c >= 'A' && c <= 'Z':
+			width += 7.5
+		default:
+			width += 6.5
+		}
+	}
+	return int(width + 0.5)
+}
+
+func makeBadge(label string, percent float64, thresholds []badgeThreshold) badge {
+	value := fmt.Sprintf("%.1f%%", percent)
+	labelWidth := textWidth(label) + 10
+	valueWidth := textWidth(value) + 10
+	return badge{
+		Label:       label,
+		Value:       value,
+		Colour:      badgeColour(thresholds, percent),
+		LabelWidth:  labelWidth,
+		ValueWidth:  valueWidth,
+		Width:       labelWidth + valueWidth,
+		LabelCentre: float64(labelWidth) / 2,
+		ValueCentre: float64(labelWidth) + float64(valueWidth)/2,
+	}
+}
+
+func writeBadge(w io.Writer, b badge) error {
+	return badgeTemplate.Execute(w, b)
+}
+
+func writeBadgeFile(filename string, out io.Writer, b badge) error {
+	return writeReportFile(filename, out, func(w io.Writer) error {
+		return writeBadge(w, b)
+	})
+}
+
+// topLevelPackages groups the packages by the first directory below the
+// directory that they all share and returns the coverage of each group.
+// Packages in the shared directory itself aren't in any group.
+func topLevelPackages(packages []*packageCoverage) map[string]*packageCoverage {
+	r := map[string]*packageCoverage{}
+	if len(packages) == 0 {
+		return r
+	}
+	prefix := packages[0].pkg
+	for _, pc := range packages[1:] {
+		for prefix != "." && prefix != "/" && pc.pkg != prefix &&
+			!strings.HasPrefix(pc.pkg, prefix+"/") {
+			prefix = path.Dir(prefix)
+		}
+	}
+	if len(packages) == 1 {
+		prefix = path.Dir(prefix)
+	}
+	for _, pc := range packages {
+		rel := pc.pkg
+		if prefix != "." {
+			rel = strings.TrimPrefix(strings.TrimPrefix(pc.pkg, prefix), "/")
+		}
+		if rel == "" {
+			continue
+		}
+		top := strings.Split(rel, "/")[0]
+		g, ok := r[top]
+		if !ok {
+			g = &packageCoverage{pkg: top}
+			r[top] = g
+		}
+		g.numStmt += pc.numStmt
+		g.covered += pc.covered
+	}
+	return r
+}
+
+func (r badgeReporter) Report(prof *profile, run *runInfo) error {
+	summary := summarize(prof)
+	b := makeBadge(r.label, summary.percent(), r.thresholds)
+	if r.perPackage && r.filename == "-" {
+		return fmt.Errorf("can't write badges per package to stdout")
+	}
+	if err := writeBadgeFile(r.filename, run.out, b); err != nil {
+		return err
+	}
+	if !r.perPackage {
+		return nil
+	}
+	base := strings.TrimSuffix(r.filename, ".svg")
+	for top, pc := range topLevelPackages(summary.packages) {
+		filename := fmt.Sprintf("%s-%s.svg", base,
+			unsafeFilenameRegexp.ReplaceAllString(top, "_"))
+		b := makeBadge(top+" "+r.label, pc.percent(), r.thresholds)
+		if err := writeBadgeFile(filename, run.out, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var badgeTemplate = template.Must(template.New("badge").Funcs(template.FuncMap{
+	"xml": template.HTMLEscapeString,
+}).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{xml .Label}}: {{xml .Value}}">
+<title>{{xml .Label}}: {{xml .Value}}</title>
+<linearGradient id="s" x2="0" y2="100%">
+<stop offset="0" stop-color="#bbb" stop-opacity=".1"/>
+<stop offset="1" stop-opacity=".1"/>
+</linearGradient>
+<clipPath id="r">
+<rect width="{{.Width}}" height="20" rx="3" fill="#fff"/>
+</clipPath>
+<g clip-path="url(#r)">
+<rect width="{{.LabelWidth}}" height="20" fill="#555"/>
+<rect x="{{.LabelWidth}}" width="{{.ValueWidth}}" height="20" fill="{{.Colour}}"/>
+<rect width="{{.Width}}" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{.LabelCentre}}" y="15" fill="#010101" fill-opacity=".3">{{xml .Label}}</text>
+<text x="{{.LabelCentre}}" y="14">{{xml .Label}}</text>
+<text x="{{.ValueCentre}}" y="15" fill="#010101" fill-opacity=".3">{{xml .Value}}</text>
+<text x="{{.ValueCentre}}" y="14">{{xml .Value}}</text>
+</g>
+</svg>
+`))
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBadgeColours(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    []badgeThreshold
+		wantErr string
+	}{
+		{in: "80:green,0:red,50:#abc",
+			want: []badgeThreshold{
+				{min: 0, colour: "#e05d44"},
+				{min: 50, colour: "#abc"},
+				{min: 80, colour: "#97ca00"},
+			}},
+		{in: "50", wantErr: "invalid badge colour: 50"},
+		{in: "x:red", wantErr: "invalid badge colour: x:red"},
+		{in: "50:pink", wantErr: "invalid badge colour: 50:pink"},
+		{in: "50:#abcd", wantErr: "invalid badge colour: 50:#abcd"},
+	}
+	for _, c := range cases {
+		got, err := parseBadgeColours(c.in)
+		if c.wantErr != "" {
+			if err == nil || err.Error() != c.wantErr {
+				t.Errorf("parseBadgeColours(%s) err: %v, want: %s", c.in, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseBadgeColours(%s) err: %s", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseBadgeColours(%s) got: %v, want: %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestBadgeColour(t *testing.T) {
+	thresholds, err := parseBadgeColours(defaultBadgeColours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		percent float64
+		want    string
+	}{
+		{percent: 0, want: "#e05d44"},
+		{percent: 69.9, want: "#fe7d37"},
+		{percent: 80, want: "#97ca00"},
+		{percent: 100, want: "#4c1"},
+	}
+	for _, c := range cases {
+		got := badgeColour(thresholds, c.percent)
+		if got != c.want {
+			t.Errorf("badgeColour(%f) got: %s, want: %s", c.percent, got, c.want)
+		}
+	}
+}
+
+func TestWriteBadge(t *testing.T) {
+	thresholds, err := parseBadgeColours(defaultBadgeColours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := writeBadge(&got, makeBadge("a<b", 85, thresholds)); err != nil {
+		t.Fatalf("writeBadge err: %s", err)
+	}
+	wants := []string{
+		`aria-label="a&lt;b: 85.0%"`,
+		`fill="#97ca00"`,
+		`<text x="51.5" y="14">85.0%</text>`,
+	}
+	for _, w := range wants {
+		if !strings.Contains(got.String(), w) {
+			t.Errorf("writeBadge got: %s, want to contain: %s", got.String(), w)
+		}
+	}
+}
+
+func TestTopLevelPackages(t *testing.T) {
+	cases := []struct {
+		packages []*packageCoverage
+		want     map[string]*packageCoverage
+	}{
+		{packages: []*packageCoverage{
+			{pkg: "github.com/a/b", numStmt: 2, covered: 1},
+			{pkg: "github.com/a/b/c", numStmt: 2, covered: 2},
+			{pkg: "github.com/a/b/c/d", numStmt: 2, covered: 0},
+			{pkg: "github.com/a/b/e", numStmt: 4, covered: 1},
+		},
+			want: map[string]*packageCoverage{
+				"c": {pkg: "c", numStmt: 4, covered: 2},
+				"e": {pkg: "e", numStmt: 4, covered: 1},
+			}},
+		{packages: []*packageCoverage{
+			{pkg: "github.com/a/b", numStmt: 2, covered: 1},
+		},
+			want: map[string]*packageCoverage{
+				"b": {pkg: "b", numStmt: 2, covered: 1},
+			}},
+		{packages: []*packageCoverage{
+			{pkg: "a/x", numStmt: 2, covered: 1},
+			{pkg: "b", numStmt: 2, covered: 1},
+		},
+			want: map[string]*packageCoverage{
+				"a": {pkg: "a", numStmt: 2, covered: 1},
+				"b": {pkg: "b", numStmt: 2, covered: 1},
+			}},
+	}
+	for _, c := range cases {
+		got := topLevelPackages(c.packages)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("topLevelPackages got: %v, want: %v", got, c.want)
+		}
+	}
+}
+
+func TestBadgeReporter_perPackage(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	prof := &profile{mode: "set", blocks: []profileBlock{
+		{file: "r/a/x.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 1, count: 1},
+		{file: "r/b/y.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 1, count: 0},
+	}}
+	r := badgeReporter{
+		filename:   filepath.Join(tmpDir, "coverage.svg"),
+		label:      "cov",
+		perPackage: true,
+	}
+	if err := r.Report(prof, &runInfo{}); err != nil {
+		t.Fatalf("Report err: %s", err)
+	}
+	wants := map[string]string{
+		"coverage.svg":   "cov: 50.0%",
+		"coverage-a.svg": "a cov: 100.0%",
+		"coverage-b.svg": "b cov: 0.0%",
+	}
+	for filename, want := range wants {
+		b, err := ioutil.ReadFile(filepath.Join(tmpDir, filename))
+		if err != nil {
+			t.Errorf("ReadFile(%s) err: %s", filename, err)
+			continue
+		}
+		if !strings.Contains(string(b), want) {
+			t.Errorf("%s doesn't contain: %s", filename, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// codecovReport is a report in Codecov's JSON coverage format.  Each line
+// is either its hit count or, if only some of the blocks on the line were
+// covered, a partial given as "covered/blocks".
+type codecovReport struct {
+	Coverage map[string]map[string]interface{} `json:"coverage"`
+}
+
+// makeCodecov converts prof into Codecov's JSON coverage format with the
+// paths of the files relative to baseDir
+func makeCodecov(
+	prof *profile,
+	resolver *pathResolver,
+	baseDir string,
+) (codecovReport, error) {
+	r := codecovReport{Coverage: map[string]map[string]interface{}{}}
+	for _, f := range summarize(prof).files {
+		path, err := resolver.relPath(baseDir, f.file)
+		if err != nil {
+			return r, err
+		}
+		lines := map[string]interface{}{}
+		for line, lh := range lineCoverage(f.blocks) {
+			if lh.covered > 0 && lh.covered < lh.blocks {
+				lines[strconv.Itoa(line)] = fmt.Sprintf("%d/%d", lh.covered, lh.blocks)
+			} else {
+				lines[strconv.Itoa(line)] = lh.count
+			}
+		}
+		r.Coverage[path] = lines
+	}
+	return r, nil
+}
+
+// writeCodecovFile writes prof to filename, or out if it is '-', in
+// Codecov's JSON coverage format
+func writeCodecovFile(
+	filename string,
+	out io.Writer,
+	prof *profile,
+	resolver *pathResolver,
+	baseDir string,
+) error {
+	report, err := makeCodecov(prof, resolver, baseDir)
+	if err != nil {
+		return err
+	}
+	return writeReportFile(filename, out, func(w io.Writer) error {
+		return writeJSON(w, report)
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestMakeCodecov(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "testdata/funcs/funcs.go"
+	prof := &profile{mode: "count", blocks: []profileBlock{
+		{file: file, startLine: 5, startCol: 31, endLine: 6, endCol: 11, numStmt: 1, count: 3},
+		{file: file, startLine: 6, startCol: 11, endLine: 8, endCol: 3, numStmt: 1, count: 0},
+		{file: file, startLine: 12, startCol: 24, endLine: 13, endCol: 10, numStmt: 1, count: 2},
+		{file: file, startLine: 13, startCol: 10, endLine: 14, endCol: 2, numStmt: 1, count: 1},
+	}}
+	report, err := makeCodecov(prof, newPathResolver(), wd)
+	if err != nil {
+		t.Fatalf("makeCodecov err: %s", err)
+	}
+	got, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"coverage":{"testdata/funcs/funcs.go":{"12":2,"13":2,"14":1,"5":3,"6":"1/2","7":0,"8":0}}}`
+	if string(got) != want {
+		t.Errorf("makeCodecov got: %s, want: %s", got, want)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type covDataError struct {
+	op     string
+	stderr string
+}
+
+func (e covDataError) Error() string {
+	return fmt.Sprintf("error from %s: %s", e.op, strings.TrimSpace(e.stderr))
+}
+
+// convertCovData converts the coverage data in dirs, written by binaries
+// built with go build -cover, into a profile
+func convertCovData(dirs []string) (*profile, error) {
+	var cmdErr bytes.Buffer
+	tmpDir, err := ioutil.TempDir("", "roveralls")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	profileFilename := filepath.Join(tmpDir, "covdata.coverprofile")
+	cmd := exec.Command("go", "tool", "covdata", "textfmt",
+		"-i="+strings.Join(dirs, ","),
+		"-o="+profileFilename,
+	)
+	cmd.Stderr = &cmdErr
+	if err := cmd.Run(); err != nil {
+		return nil, covDataError{op: "go tool covdata", stderr: cmdErr.String()}
+	}
+	f, err := os.Open(profileFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	prof, err := parseProfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing covdata profile: %s", err)
+	}
+	return prof, nil
+}
+
+// isMainPackage returns true if the non-test Go files in dir are in
+// package main
+func isMainPackage(dir string) (bool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return false, fmt.Errorf("error checking for Go files")
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return false, err
+		}
+		if f.Name.Name == "main" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findMainPackages returns the directories under wd containing a main
+// package
+func (p *Program) findMainPackages(wd string) ([]string, error) {
+	dirs := []string{}
+	err := filepath.Walk(wd, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(wd, path)
+		if err != nil {
+			return fmt.Errorf("error creating relative path")
+		}
+		if p.ignoreDir(rel) {
+			return filepath.SkipDir
+		}
+		isMain, err := isMainPackage(path)
+		if err != nil {
+			return err
+		}
+		if isMain {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// buildCoverBinaries builds each main package under wd with -cover and
+// returns the directories of the binaries.  Each binary is put in binDir
+// under the package's directory relative to wd, so that main packages with
+// the same name don't overwrite each other.
+func (p *Program) buildCoverBinaries(
+	wd string,
+	binDir string,
+) ([]string, error) {
+	dirs, err := p.findMainPackages(wd)
+	if err != nil {
+		return nil, err
+	}
+	binDirs := []string{}
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(wd, dir)
+		if err != nil {
+			return nil, fmt.Errorf("error creating relative path")
+		}
+		pkgBinDir := filepath.Join(binDir, rel)
+		if err := os.MkdirAll(pkgBinDir, 0755); err != nil {
+			return nil, err
+		}
+		var cmdErr bytes.Buffer
+		binFilename := filepath.Join(pkgBinDir, filepath.Base(dir))
+		args := []string{"build", "-cover", "-covermode=" + p.cover,
+			"-o", binFilename}
+		if p.verbose {
+			fmt.Fprintf(p.out, "Building: go %s in dir: %s\n",
+				strings.Join(args, " "), dir)
+		}
+		cmd := exec.Command("go", args...)
+		cmd.Dir = dir
+		cmd.Stderr = &cmdErr
+		if err := cmd.Run(); err != nil {
+			return nil, covDataError{op: "go build -cover", stderr: cmdErr.String()}
+		}
+		binDirs = append(binDirs, pkgBinDir)
+	}
+	return binDirs, nil
+}
+
+// runCoverScript builds the main packages with -cover and runs
+// p.coverScript against them.  The coverage data is written to covDir.
+func (p *Program) runCoverScript(wd string, covDir string) error {
+	binDir, err := ioutil.TempDir("", "roveralls")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(binDir)
+
+	binDirs, err := p.buildCoverBinaries(wd, binDir)
+	if err != nil {
+		return err
+	}
+	if p.verbose {
+		fmt.Fprintf(p.out, "Running cover script: %s\n", p.coverScript)
+	}
+	cmd := exec.Command("sh", "-c", p.coverScript)
+	cmd.Dir = wd
+	cmd.Env = append(os.Environ(),
+		"GOCOVERDIR="+covDir,
+		"ROVERALLS_BINDIR="+binDir,
+		"PATH="+strings.Join(append(binDirs, os.Getenv("PATH")),
+			string(os.PathListSeparator)),
+	)
+	cmd.Stdout = p.out
+	cmd.Stderr = p.outErr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running cover script: %s", err)
+	}
+	return nil
+}
+
+// integrationProfile returns the coverage from the GOCOVERDIR directories
+// given with -covdata and from running the -cover-script
+func (p *Program) integrationProfile(wd string) (*profile, error) {
+	dirs := []string{}
+	if p.covDataDirs != "" {
+		dirs = strings.Split(p.covDataDirs, ",")
+	}
+	if p.coverScript != "" {
+		covDir, err := ioutil.TempDir("", "roveralls")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(covDir)
+		if err := p.runCoverScript(wd, covDir); err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, covDir)
+	}
+	prof, err := convertCovData(dirs)
+	if err != nil {
+		return nil, err
+	}
+	if prof.mode != "" && prof.mode != p.cover {
+		return nil, fmt.Errorf("covdata has mode: %s, but covermode is: %s",
+			prof.mode, p.cover)
+	}
+	return prof, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIsMainPackage(t *testing.T) {
+	cases := []struct {
+		dir  string
+		want bool
+	}{
+		{dir: filepath.Join("testdata", "covbin"), want: true},
+		{dir: filepath.Join("fixtures", "good"), want: false},
+		{dir: filepath.Join("fixtures", "no-go-files"), want: false},
+	}
+	for _, c := range cases {
+		got, err := isMainPackage(c.dir)
+		if err != nil {
+			t.Errorf("isMainPackage(%s) err: %s", c.dir, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("isMainPackage(%s) got: %t, want: %t", c.dir, got, c.want)
+		}
+	}
+}
+
+func TestBuildCoverBinaries(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	binDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binDir)
+	src := []byte("package main\n\nfunc main() {}\n")
+	for _, dir := range []string{"cmd/foo", "tools/foo"} {
+		pkgDir := filepath.Join(srcDir, filepath.FromSlash(dir))
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := ioutil.WriteFile(filepath.Join(pkgDir, "main.go"), src, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	program := &Program{cover: "set", ignores: map[string]bool{}}
+	got, err := program.buildCoverBinaries(srcDir, binDir)
+	if err != nil {
+		t.Fatalf("buildCoverBinaries err: %s", err)
+	}
+	want := []string{
+		filepath.Join(binDir, "cmd", "foo"),
+		filepath.Join(binDir, "tools", "foo"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildCoverBinaries got: %v, want: %v", got, want)
+	}
+	for _, dir := range want {
+		if _, err := os.Stat(filepath.Join(dir, "foo")); err != nil {
+			t.Errorf("buildCoverBinaries binary not built: %s", err)
+		}
+	}
+}
+
+func TestRun_coverScript(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{os.Args[0], "-cover-script", "covbin world"}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir(filepath.Join("testdata", "covbin")); err != nil {
+		t.Fatalf("ChDir err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+	if gotOut.String() != "hello world\n" {
+		t.Errorf("Run: gotOut: %s, want: hello world", gotOut.String())
+	}
+
+	f, err := os.Open(outFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	prof, err := parseProfile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numStmt, covered := prof.coverage()
+	if numStmt != 4 || covered != 3 {
+		t.Errorf("coverage got: %d/%d statements, want: 3/4", covered, numStmt)
+	}
+}
+
+func TestRun_covdataErrors(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{os.Args[0], "-covdata", filepath.Join(wd, "nonexistant")}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir(filepath.Join("fixtures", "good")); err != nil {
+		t.Fatalf("ChDir err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	if exitCode := program.Run(); exitCode != 1 {
+		t.Errorf("Run: incorrect exit code, got: %d, want: 1", exitCode)
+	}
+	if !bytes.Contains(gotErr.Bytes(), []byte("error from go tool covdata:")) {
+		t.Errorf("Run: gotErr: %s", gotErr.String())
+	}
+}
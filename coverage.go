@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"path"
+	"sort"
+)
+
+// fileCoverage is the coverage of a single source file
+type fileCoverage struct {
+	file    string
+	pkg     string
+	numStmt int
+	covered int
+	blocks  []profileBlock
+}
+
+// packageCoverage is the coverage of a package
+type packageCoverage struct {
+	pkg     string
+	numStmt int
+	covered int
+	files   []*fileCoverage
+}
+
+// coverageSummary is the coverage of a profile broken down by package and
+// file, with the packages and files sorted by path
+type coverageSummary struct {
+	numStmt  int
+	covered  int
+	packages []*packageCoverage
+	files    []*fileCoverage
+}
+
+// lineHits is the coverage of a single source line
+type lineHits struct {
+	// blocks is the number of blocks with statements on the line
+	blocks int
+	// covered is the number of those blocks that were covered
+	covered int
+	// count is the highest count of those blocks
+	count int
+}
+
+func (f *fileCoverage) percent() float64 {
+	return percent(f.covered, f.numStmt)
+}
+
+func (pc *packageCoverage) percent() float64 {
+	return percent(pc.covered, pc.numStmt)
+}
+
+func (s *coverageSummary) percent() float64 {
+	return percent(s.covered, s.numStmt)
+}
+
+// summarize works out the coverage of each file and package in prof
+func summarize(prof *profile) *coverageSummary {
+	s := &coverageSummary{}
+	files := map[string]*fileCoverage{}
+	packages := map[string]*packageCoverage{}
+	for _, b := range prof.blocks {
+		f, ok := files[b.file]
+		if !ok {
+			f = &fileCoverage{file: b.file, pkg: path.Dir(b.file)}
+			files[b.file] = f
+			s.files = append(s.files, f)
+		}
+		f.blocks = append(f.blocks, b)
+		f.numStmt += b.numStmt
+		s.numStmt += b.numStmt
+		if b.count > 0 {
+			f.covered += b.numStmt
+			s.covered += b.numStmt
+		}
+	}
+	sort.Slice(s.files, func(i, j int) bool {
+		return s.files[i].file < s.files[j].file
+	})
+	for _, f := range s.files {
+		pc, ok := packages[f.pkg]
+		if !ok {
+			pc = &packageCoverage{pkg: f.pkg}
+			packages[f.pkg] = pc
+			s.packages = append(s.packages, pc)
+		}
+		pc.files = append(pc.files, f)
+		pc.numStmt += f.numStmt
+		pc.covered += f.covered
+	}
+	sort.Slice(s.packages, func(i, j int) bool {
+		return s.packages[i].pkg < s.packages[j].pkg
+	})
+	return s
+}
+
+// blockLines returns the first and last source line of a block.  A block
+// that ends at the start of a line doesn't include that line.
+func blockLines(b profileBlock) (int, int) {
+	if b.endCol <= 1 && b.endLine > b.startLine {
+		return b.startLine, b.endLine - 1
+	}
+	return b.startLine, b.endLine
+}
+
+// lineCoverage returns the coverage of each line of a file from its blocks.
+// Blocks without any statements are ignored.
+func lineCoverage(blocks []profileBlock) map[int]*lineHits {
+	lines := map[int]*lineHits{}
+	for _, b := range blocks {
+		if b.numStmt == 0 {
+			continue
+		}
+		first, last := blockLines(b)
+		for line := first; line <= last; line++ {
+			lh, ok := lines[line]
+			if !ok {
+				lh = &lineHits{}
+				lines[line] = lh
+			}
+			lh.blocks++
+			if b.count > 0 {
+				lh.covered++
+			}
+			if b.count > lh.count {
+				lh.count = b.count
+			}
+		}
+	}
+	return lines
+}
+
+// sortedLines returns the line numbers in lines in ascending order
+func sortedLines(lines map[int]*lineHits) []int {
+	r := make([]int, 0, len(lines))
+	for line := range lines {
+		r = append(r, line)
+	}
+	sort.Ints(r)
+	return r
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	prof := &profile{mode: "set", blocks: []profileBlock{
+		{file: "a/b/y.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 2, count: 0},
+		{file: "a/b/x.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 3, count: 1},
+		{file: "a/x.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 1, count: 1},
+	}}
+	s := summarize(prof)
+	if s.numStmt != 6 || s.covered != 4 {
+		t.Errorf("summarize got: %d/%d, want: 4/6", s.covered, s.numStmt)
+	}
+	gotPkgs := []string{}
+	for _, pc := range s.packages {
+		gotPkgs = append(gotPkgs, pc.pkg)
+	}
+	wantPkgs := []string{"a", "a/b"}
+	if !reflect.DeepEqual(gotPkgs, wantPkgs) {
+		t.Errorf("summarize got packages: %v, want: %v", gotPkgs, wantPkgs)
+	}
+	pc := s.packages[1]
+	if pc.numStmt != 5 || pc.covered != 3 || len(pc.files) != 2 ||
+		pc.files[0].file != "a/b/x.go" {
+		t.Errorf("summarize got package: %v", pc)
+	}
+}
+
+func TestLineCoverage(t *testing.T) {
+	blocks := []profileBlock{
+		{startLine: 1, startCol: 10, endLine: 3, endCol: 2, numStmt: 2, count: 3},
+		{startLine: 3, startCol: 2, endLine: 5, endCol: 1, numStmt: 1, count: 0},
+		{startLine: 7, startCol: 1, endLine: 7, endCol: 9, numStmt: 0, count: 0},
+	}
+	got := lineCoverage(blocks)
+	want := map[int]*lineHits{
+		1: {blocks: 1, covered: 1, count: 3},
+		2: {blocks: 1, covered: 1, count: 3},
+		3: {blocks: 2, covered: 1, count: 3},
+		4: {blocks: 1, covered: 0, count: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lineCoverage got: %v, want: %v", got, want)
+	}
+	if gotLines := sortedLines(got); !reflect.DeepEqual(gotLines, []int{1, 2, 3, 4}) {
+		t.Errorf("sortedLines got: %v", gotLines)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultCoverallsEndpoint = "https://coveralls.io"
+
+// coverallsJob is a job submitted to the Coveralls API
+type coverallsJob struct {
+	RepoToken          string                `json:"repo_token,omitempty"`
+	ServiceName        string                `json:"service_name,omitempty"`
+	ServiceJobID       string                `json:"service_job_id,omitempty"`
+	ServiceNumber      string                `json:"service_number,omitempty"`
+	ServicePullRequest string                `json:"service_pull_request,omitempty"`
+	Git                *coverallsGit         `json:"git,omitempty"`
+	SourceFiles        []coverallsSourceFile `json:"source_files"`
+}
+
+// coverallsSourceFile is a source file and the number of times each of
+// its lines was run, with nil for lines without any statements
+type coverallsSourceFile struct {
+	Name         string `json:"name"`
+	SourceDigest string `json:"source_digest"`
+	Coverage     []*int `json:"coverage"`
+}
+
+type coverallsGit struct {
+	Head    coverallsHead     `json:"head"`
+	Branch  string            `json:"branch,omitempty"`
+	Remotes []coverallsRemote `json:"remotes,omitempty"`
+}
+
+type coverallsHead struct {
+	ID             string `json:"id"`
+	AuthorName     string `json:"author_name"`
+	AuthorEmail    string `json:"author_email"`
+	CommitterName  string `json:"committer_name"`
+	CommitterEmail string `json:"committer_email"`
+	Message        string `json:"message"`
+}
+
+type coverallsRemote struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// coverallsResponse is the response from the Coveralls API
+type coverallsResponse struct {
+	Message string `json:"message"`
+	URL     string `json:"url"`
+	Error   bool   `json:"error"`
+}
+
+// ciService is the CI service that a job is running on
+type ciService struct {
+	name        string
+	jobID       string
+	number      string
+	pullRequest string
+	branch      string
+}
+
+// coverallsReporter uploads the coverage to the Coveralls API at endpoint
+type coverallsReporter struct {
+	endpoint string
+	getenv   func(string) string
+}
+
+// detectCIService works out the CI service from its environment variables.
+// COVERALLS_SERVICE_NAME and COVERALLS_SERVICE_JOB_ID override the
+// detected values.
+func detectCIService(getenv func(string) string) ciService {
+	var s ciService
+	switch {
+	case getenv("GITHUB_ACTIONS") != "":
+		s = ciService{
+			name:   "github",
+			jobID:  getenv("GITHUB_RUN_ID"),
+			number: getenv("GITHUB_RUN_NUMBER"),
+			branch: getenv("GITHUB_HEAD_REF"),
+		}
+		if s.branch == "" {
+			s.branch = getenv("GITHUB_REF_NAME")
+		}
+		ref := getenv("GITHUB_REF")
+		if strings.HasPrefix(ref, "refs/pull/") {
+			s.pullRequest = strings.Split(strings.TrimPrefix(ref, "refs/pull/"), "/")[0]
+		}
+	case getenv("TRAVIS") != "":
+		s = ciService{
+			name:   "travis-ci",
+			jobID:  getenv("TRAVIS_JOB_ID"),
+			number: getenv("TRAVIS_BUILD_NUMBER"),
+			branch: getenv("TRAVIS_BRANCH"),
+		}
+		if pr := getenv("TRAVIS_PULL_REQUEST"); pr != "false" {
+			s.pullRequest = pr
+		}
+	case getenv("CIRCLECI") != "":
+		s = ciService{
+			name:        "circleci",
+			jobID:       getenv("CIRCLE_BUILD_NUM"),
+			number:      getenv("CIRCLE_WORKFLOW_ID"),
+			pullRequest: getenv("CIRCLE_PR_NUMBER"),
+			branch:      getenv("CIRCLE_BRANCH"),
+		}
+	case getenv("APPVEYOR") != "":
+		s = ciService{
+			name:        "appveyor",
+			jobID:       getenv("APPVEYOR_JOB_ID"),
+			number:      getenv("APPVEYOR_BUILD_NUMBER"),
+			pullRequest: getenv("APPVEYOR_PULL_REQUEST_NUMBER"),
+			branch:      getenv("APPVEYOR_REPO_BRANCH"),
+		}
+	case getenv("GITLAB_CI") != "":
+		s = ciService{
+			name:        "gitlab-ci",
+			jobID:       getenv("CI_JOB_ID"),
+			number:      getenv("CI_PIPELINE_IID"),
+			pullRequest: getenv("CI_MERGE_REQUEST_IID"),
+			branch:      getenv("CI_COMMIT_REF_NAME"),
+		}
+	case getenv("JENKINS_URL") != "":
+		s = ciService{
+			name:        "jenkins",
+			jobID:       getenv("BUILD_NUMBER"),
+			number:      getenv("BUILD_NUMBER"),
+			pullRequest: getenv("CHANGE_ID"),
+			branch:      getenv("BRANCH_NAME"),
+		}
+	}
+	if name := getenv("COVERALLS_SERVICE_NAME"); name != "" {
+		s.name = name
+	}
+	if jobID := getenv("COVERALLS_SERVICE_JOB_ID"); jobID != "" {
+		s.jobID = jobID
+	}
+	return s
+}
+
+// gitInfo returns the details of the commit checked out in the working
+// directory or nil if it isn't in a git repository
+func gitInfo(branch string) *coverallsGit {
+	out := commandOutput("git", "log", "-1",
+		"--format=%H%n%an%n%ae%n%cn%n%ce%n%s")
+	fields := strings.SplitN(out, "\n", 6)
+	if len(fields) != 6 {
+		return nil
+	}
+	g := &coverallsGit{
+		Head: coverallsHead{
+			ID:             fields[0],
+			AuthorName:     fields[1],
+			AuthorEmail:    fields[2],
+			CommitterName:  fields[3],
+			CommitterEmail: fields[4],
+			Message:        fields[5],
+		},
+		Branch: branch,
+	}
+	if g.Branch == "" {
+		g.Branch = commandOutput("git", "rev-parse", "--abbrev-ref", "HEAD")
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(commandOutput("git", "remote", "-v"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		g.Remotes = append(g.Remotes, coverallsRemote{Name: fields[0], URL: fields[1]})
+	}
+	return g
+}
+
+// coverallsSourceFiles returns the coverage of each line of the files in
+// prof, with the paths of the files relative to baseDir
+func coverallsSourceFiles(
+	prof *profile,
+	resolver *pathResolver,
+	baseDir string,
+) ([]coverallsSourceFile, error) {
+	r := []coverallsSourceFile{}
+	for _, f := range summarize(prof).files {
+		filename, err := resolver.resolve(f.file)
+		if err != nil {
+			return nil, err
+		}
+		name, err := resolver.relPath(baseDir, f.file)
+		if err != nil {
+			return nil, err
+		}
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		numLines := strings.Count(string(src), "\n")
+		if len(src) > 0 && src[len(src)-1] != '\n' {
+			numLines++
+		}
+		coverage := make([]*int, numLines)
+		for line, lh := range lineCoverage(f.blocks) {
+			if line < 1 || line > numLines {
+				return nil, fmt.Errorf("line %d out of range in: %s", line, f.file)
+			}
+			count := lh.count
+			coverage[line-1] = &count
+		}
+		r = append(r, coverallsSourceFile{
+			Name:         name,
+			SourceDigest: fmt.Sprintf("%x", md5.Sum(src)),
+			Coverage:     coverage,
+		})
+	}
+	return r, nil
+}
+
+// makeCoverallsJob creates the Coveralls job for prof, taking the service
+// details and repo token from the environment
+func makeCoverallsJob(
+	prof *profile,
+	run *runInfo,
+	getenv func(string) string,
+) (coverallsJob, error) {
+	service := detectCIService(getenv)
+	sourceFiles, err := coverallsSourceFiles(prof, run.resolver, run.wd)
+	if err != nil {
+		return coverallsJob{}, err
+	}
+	return coverallsJob{
+		RepoToken:          getenv("COVERALLS_REPO_TOKEN"),
+		ServiceName:        service.name,
+		ServiceJobID:       service.jobID,
+		ServiceNumber:      service.number,
+		ServicePullRequest: service.pullRequest,
+		Git:                gitInfo(service.branch),
+		SourceFiles:        sourceFiles,
+	}, nil
+}
+
+// uploadCoveralls posts job to the Coveralls API at endpoint
+func uploadCoveralls(endpoint string, job coverallsJob) (coverallsResponse, error) {
+	var response coverallsResponse
+	b, err := json.Marshal(job)
+	if err != nil {
+		return response, err
+	}
+	client := &http.Client{Timeout: time.Minute}
+	res, err := client.PostForm(
+		strings.TrimSuffix(endpoint, "/")+"/api/v1/jobs",
+		url.Values{"json": {string(b)}},
+	)
+	if err != nil {
+		return response, fmt.Errorf("error uploading to coveralls: %s", err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return response, fmt.Errorf("error uploading to coveralls: %s", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return response, fmt.Errorf("error uploading to coveralls: %s, %s",
+			res.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return response, fmt.Errorf("error uploading to coveralls: %s", err)
+	}
+	if response.Error {
+		return response, fmt.Errorf("error uploading to coveralls: %s",
+			response.Message)
+	}
+	return response, nil
+}
+
+func (r coverallsReporter) Report(prof *profile, run *runInfo) error {
+	job, err := makeCoverallsJob(prof, run, r.getenv)
+	if err != nil {
+		return err
+	}
+	response, err := uploadCoveralls(r.endpoint, job)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(run.out, "Coveralls: %s %s\n", response.Message, response.URL)
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func makeGetenv(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
+
+func TestDetectCIService(t *testing.T) {
+	cases := []struct {
+		env  map[string]string
+		want ciService
+	}{
+		{env: map[string]string{}, want: ciService{}},
+		{env: map[string]string{
+			"GITHUB_ACTIONS":    "true",
+			"GITHUB_RUN_ID":     "123",
+			"GITHUB_RUN_NUMBER": "7",
+			"GITHUB_REF":        "refs/pull/42/merge",
+			"GITHUB_HEAD_REF":   "feature",
+		},
+			want: ciService{
+				name:        "github",
+				jobID:       "123",
+				number:      "7",
+				pullRequest: "42",
+				branch:      "feature",
+			}},
+		{env: map[string]string{
+			"TRAVIS":              "true",
+			"TRAVIS_JOB_ID":       "99",
+			"TRAVIS_BUILD_NUMBER": "3",
+			"TRAVIS_PULL_REQUEST": "false",
+			"TRAVIS_BRANCH":       "master",
+		},
+			want: ciService{
+				name:   "travis-ci",
+				jobID:  "99",
+				number: "3",
+				branch: "master",
+			}},
+		{env: map[string]string{
+			"TRAVIS":                   "true",
+			"TRAVIS_JOB_ID":            "99",
+			"COVERALLS_SERVICE_NAME":   "travis-pro",
+			"COVERALLS_SERVICE_JOB_ID": "100",
+		},
+			want: ciService{name: "travis-pro", jobID: "100"}},
+	}
+	for _, c := range cases {
+		got := detectCIService(makeGetenv(c.env))
+		if got != c.want {
+			t.Errorf("detectCIService(%v) got: %v, want: %v", c.env, got, c.want)
+		}
+	}
+}
+
+func TestCoverallsReporter(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotJob coverallsJob
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			gotPath = r.URL.Path
+			if err := json.Unmarshal([]byte(r.FormValue("json")), &gotJob); err != nil {
+				t.Errorf("Unmarshal err: %s", err)
+			}
+			w.Write([]byte(`{"message":"Job #1.1","url":"https://coveralls.example/jobs/1"}`))
+		}))
+	defer server.Close()
+
+	file := "testdata/funcs/funcs.go"
+	prof := &profile{mode: "count", blocks: []profileBlock{
+		{file: file, startLine: 16, startCol: 18, endLine: 18, endCol: 2, numStmt: 1, count: 2},
+		{file: file, startLine: 12, startCol: 24, endLine: 14, endCol: 2, numStmt: 1, count: 0},
+	}}
+	var out bytes.Buffer
+	run := &runInfo{wd: wd, resolver: newPathResolver(), out: &out}
+	r := coverallsReporter{
+		endpoint: server.URL,
+		getenv: makeGetenv(map[string]string{
+			"COVERALLS_REPO_TOKEN": "secret",
+			"GITHUB_ACTIONS":       "true",
+			"GITHUB_RUN_ID":        "123",
+		}),
+	}
+	if err := r.Report(prof, run); err != nil {
+		t.Fatalf("Report err: %s", err)
+	}
+	if gotPath != "/api/v1/jobs" {
+		t.Errorf("Report posted to: %s, want: /api/v1/jobs", gotPath)
+	}
+	if gotJob.RepoToken != "secret" || gotJob.ServiceName != "github" ||
+		gotJob.ServiceJobID != "123" {
+		t.Errorf("Report got job: %v", gotJob)
+	}
+	if len(gotJob.SourceFiles) != 1 {
+		t.Fatalf("Report got source files: %v", gotJob.SourceFiles)
+	}
+	sf := gotJob.SourceFiles[0]
+	if sf.Name != file || len(sf.SourceDigest) != 32 {
+		t.Errorf("Report got source file: %v", sf)
+	}
+	want := []interface{}{
+		nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil,
+		0, 0, 0, nil, 2, 2, 2,
+	}
+	if len(sf.Coverage) != len(want) {
+		t.Fatalf("Report got coverage length: %d, want: %d",
+			len(sf.Coverage), len(want))
+	}
+	for i, w := range want {
+		c := sf.Coverage[i]
+		if (w == nil) != (c == nil) || (c != nil && *c != w.(int)) {
+			t.Errorf("Report got coverage of line %d: %v, want: %v", i+1, c, w)
+		}
+	}
+	wantOut := "Coveralls: Job #1.1 https://coveralls.example/jobs/1\n"
+	if out.String() != wantOut {
+		t.Errorf("Report got out: %s, want: %s", out.String(), wantOut)
+	}
+}
+
+func TestCoverallsReporter_errors(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message":"Couldn't find a repository","error":true}`, 422)
+		}))
+	defer server.Close()
+
+	prof := &profile{mode: "set"}
+	run := &runInfo{wd: wd, resolver: newPathResolver(), out: &bytes.Buffer{}}
+	r := coverallsReporter{endpoint: server.URL, getenv: makeGetenv(nil)}
+	err = r.Report(prof, run)
+	want := "error uploading to coveralls: 422 Unprocessable Entity, " +
+		`{"message":"Couldn't find a repository","error":true}`
+	if err == nil || err.Error() != want {
+		t.Errorf("Report err: %v, want: %s", err, want)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// changedLines maps the path of each file changed in a diff, relative to
+// the top of the git repository, to the lines that were added or changed
+type changedLines map[string]map[int]bool
+
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// parseDiff finds the lines added or changed in a unified diff
+func parseDiff(r io.Reader) (changedLines, error) {
+	changed := changedLines{}
+	var lines map[int]bool
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file := strings.TrimPrefix(line, "+++ ")
+			if file == "/dev/null" {
+				lines = nil
+				continue
+			}
+			file = strings.TrimPrefix(file, "b/")
+			lines = map[int]bool{}
+			changed[file] = lines
+		case strings.HasPrefix(line, "@@ "):
+			m := hunkHeaderRegexp.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("invalid diff hunk: %s", line)
+			}
+			if lines == nil {
+				continue
+			}
+			start, _ := strconv.Atoi(m[1])
+			count := 1
+			if m[2] != "" {
+				count, _ = strconv.Atoi(m[2])
+			}
+			for i := start; i < start+count; i++ {
+				lines[i] = true
+			}
+		}
+	}
+	return changed, scanner.Err()
+}
+
+// gitChangedLines returns the lines changed since the git ref base and the
+// top directory of the git repository that their paths are relative to.
+// The changes are found from where HEAD branched from base, so that
+// changes made to base since don't count, and include uncommitted changes
+// as they are in the coverage profile.
+func gitChangedLines(base string) (changedLines, string, error) {
+	root := gitRoot()
+	if root == "" {
+		return nil, "", fmt.Errorf("can't find top of git repository")
+	}
+	mergeBase, err := runGit(root, "merge-base", base, "HEAD")
+	if err != nil {
+		return nil, "", err
+	}
+	diff, err := runGit(root, "diff", "-U0", "--no-color", "--no-ext-diff",
+		strings.TrimSpace(mergeBase), "--")
+	if err != nil {
+		return nil, "", err
+	}
+	changed, err := parseDiff(strings.NewReader(diff))
+	return changed, root, err
+}
+
+// runGit runs a git command in dir and returns its output
+func runGit(dir string, args ...string) (string, error) {
+	var cmdOut bytes.Buffer
+	var cmdErr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &cmdOut
+	cmd.Stderr = &cmdErr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error from git %s: %s", args[0],
+			strings.TrimSpace(cmdErr.String()))
+	}
+	return cmdOut.String(), nil
+}
+
+// gitRoot returns the top directory of the git repository that the working
+// directory is in or "" if it isn't in one
+func gitRoot() string {
+	return commandOutput("git", "rev-parse", "--show-toplevel")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	diff := `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3 +3 @@ func A() {
+-	return 1
++	return 2
+@@ -10,0 +11,3 @@ func B() {
++	x := 1
++	y := 2
++	return x + y
+@@ -20,2 +23,0 @@ func C() {
+-	a()
+-	b()
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package x
+-
+diff --git a/sub/new.go b/sub/new.go
+new file mode 100644
+--- /dev/null
++++ b/sub/new.go
+@@ -0,0 +1,2 @@
++package sub
++
+`
+	got, err := parseDiff(strings.NewReader(diff))
+	if err != nil {
+		t.Fatalf("parseDiff err: %s", err)
+	}
+	want := changedLines{
+		"a.go":       {3: true, 11: true, 12: true, 13: true},
+		"sub/new.go": {1: true, 2: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDiff got: %v, want: %v", got, want)
+	}
+}
+
+func TestParseDiff_errors(t *testing.T) {
+	diff := "+++ b/a.go\n@@ bob @@\n"
+	_, err := parseDiff(strings.NewReader(diff))
+	want := "invalid diff hunk: @@ bob @@"
+	if err == nil || err.Error() != want {
+		t.Errorf("parseDiff err: %v, want: %s", err, want)
+	}
+}
+
+func TestGitChangedLines(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	filename := filepath.Join(tmpDir, "a.go")
+	writeLines := func(lines ...string) {
+		content := strings.Join(lines, "\n") + "\n"
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=test",
+			"-c", "user.email=test@example.com"}, args...)
+		if _, err := runGit(tmpDir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	writeLines("1", "2", "3", "4", "5")
+	git("add", "a.go")
+	git("commit", "-q", "-m", "first")
+	git("branch", "base")
+	git("checkout", "-q", "-b", "feature")
+	writeLines("1", "2 feature", "3", "4", "5")
+	git("commit", "-q", "-am", "feature")
+	// The base moves on after the feature branched from it
+	git("checkout", "-q", "base")
+	writeLines("1", "2", "3", "4", "5 base")
+	git("commit", "-q", "-am", "base")
+	git("checkout", "-q", "feature")
+	// Uncommitted changes count
+	writeLines("1", "2 feature", "3 uncommitted", "4", "5")
+
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := gitChangedLines("base")
+	if err != nil {
+		t.Fatalf("gitChangedLines err: %s", err)
+	}
+	want := changedLines{"a.go": {2: true, 3: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("gitChangedLines got: %v, want: %v", got, want)
+	}
+	if _, _, err := gitChangedLines("nonexistant"); err == nil {
+		t.Errorf("gitChangedLines(nonexistant) got no error")
+	}
+}
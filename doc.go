@@ -5,6 +5,10 @@ roveralls runs coverage tests on a package and all its sub-packages.  The covera
 
 This tool was inspired by https://github.com/go-playground/overalls written by Dean Karn, but I found it difficult to test and brittle so I decided to rewrite it from scratch.  Thanks for the inspiration Dean.
 
+Requirements
+
+roveralls needs Go 1.20 or later to build and to merge the coverage of binaries built with 'go build -cover'.
+
 Usage
 
 At its simplest, to test the current package and sub-packages and create a 'roveralls.coverprofile' file in the directory that you run the command:
@@ -19,17 +23,306 @@ To see the help for the command:
       coverage profile is output as a single file called 'roveralls.coverprofile'
       for use by tools such as goveralls.
 
+      Subcommands:
+        merge     Merge existing coverage profiles into one
+        validate  Check that coverage profiles are well-formed
+        history   Show the trend of the coverage recorded with -history
+
+      Run 'roveralls <subcommand> -help' for help on a subcommand.
+
       Usage of roveralls:
+        -badge filename
+            Write an SVG badge of the total coverage to filename, '-' for stdout
+        -badge-colours percent:colour,...
+            Colour of the badge from each percentage up: percent:colour,... where colour is a name or #hex (default "0:red,50:orange,70:yellow,80:green,90:brightgreen")
+        -badge-label text
+            Label text of the badge (default "coverage")
+        -badge-per-package
+            Also write a badge for each top-level package, named after the package
+        -baseline filename
+            Coverage profile filename to compare the coverage with in the Markdown report
+        -codecov filename
+            Write a Codecov JSON coverage report to filename, '-' for stdout
+        -covdata dir1,dir2,...
+            Comma separated list of GOCOVERDIR directories to merge into the profile: dir1,dir2,...
+        -cover-script script
+            Build the main packages with -cover and run script against them, merging the coverage into the profile
+        -coveralls
+            Upload the coverage to Coveralls, using the repo token in COVERALLS_REPO_TOKEN
+        -coveralls-endpoint url
+            The url of the Coveralls API to upload to (default "https://coveralls.io")
         -covermode count,set,atomic
             Mode to run when testing files: count,set,atomic (default "count")
+        -diff-base ref
+            Git ref that changed lines, including uncommitted ones, are found from its merge base with HEAD (default origin/$GITHUB_BASE_REF if set)
+        -drop-empty
+            Drop blocks without any statements from the profile
+        -failure-logs dir
+            Write the full go test logs of failing packages to dir
+        -func filename
+            Write the coverage of each function to filename, '-' for stdout
+        -func-format text,json
+            Format of the function coverage report: text,json (default "text")
+        -func-min percent
+            Only report functions with at least percent coverage
+        -func-sort file,name,coverage,statements
+            Order of the function coverage report: file,name,coverage,statements (default "file")
+        -github-annotations
+            Output GitHub Actions warnings for the uncovered lines changed since -diff-base
+        -github-annotations-max number
+            Maximum number of GitHub Actions warnings for each file (default 10)
         -help
             Display this help
+        -history filename
+            Append a record of the coverage to the history file filename, '-' for stdout
+        -html dir
+            Write an HTML coverage report to dir
         -ignore dir1,dir2,...
-            Comma separated list of directory names to ignore: dir1,dir2,... (default ".git,vendor")
+            Comma separated list of directory names to ignore, as well as testdata: dir1,dir2,... (default ".git,vendor")
+        -include-untested
+            Include packages without test files as zero coverage
+        -json-summary filename
+            Write a JSON summary of the coverage and run to filename, '-' for stdout
+        -junit filename
+            Write a JUnit XML report of the tests run to filename
+        -list-uncovered
+            List each uncovered block as 'path:line:col: uncovered (N statements)'
+        -list-uncovered-glob glob
+            Only list uncovered blocks in files matching glob, matched against the name of the file if it has no '/'
+        -list-uncovered-min n
+            Only list uncovered blocks with at least n statements
+        -list-uncovered-pkg pkg1,pkg2/...
+            Only list uncovered blocks in the packages: pkg1,pkg2/...
+        -markdown filename
+            Write a Markdown report to filename, '-' for stdout, also appending it to $GITHUB_STEP_SUMMARY if set
+        -matrix 'tags=t1,t2 goarch=arch env=NAME=VALUE'
+            Run the tests under a configuration, may be given more than once: 'tags=t1,t2 goarch=arch env=NAME=VALUE' or 'default'
+        -outdir dir
+            Keep the raw profile, output and timing of each package in dir
+        -path-prefix-map old=new
+            Replace the prefix of paths in the profile, may be given more than once: old=new
+        -path-style import,relative,absolute
+            Style of the paths to source files in the profile: import,relative,absolute (default "import")
+        -report name=dest
+            Write a report, may be given more than once: name=dest where name is one of: badge,codecov,coveralls,func,github-annotations,history,html,json-summary,list-uncovered,markdown,sarif,sonar,text
+        -sarif filename
+            Write a SARIF log of the uncovered code in the files changed since -diff-base, or all files, to filename, '-' for stdout
+        -sarif-by block,func
+            Write a SARIF result for each uncovered: block,func (default "block")
+        -shard i/n
+            Only test the packages in shard i/n, writing the profile and timings to files named after the shard
         -short
             Tell long-running tests to shorten their run time
+        -sonar filename
+            Write a SonarQube generic coverage XML report to filename, '-' for stdout
+        -sonar-base dir
+            Project base dir that the paths in the SonarQube report are relative to (default working directory)
+        -timings file1,file2,...
+            Comma separated list of timings files used to balance shards: file1,file2,...
         -v	Verbose output
 
+Untested Packages
+
+By default directories without any test files are skipped, which means that their code doesn't count towards the total.  To include packages that have Go files but no tests as zero coverage use:
+
+    roveralls -include-untested
+
+Go 1.22 and later output a coverage profile for packages without test files.  With earlier versions the tests are run again with an empty test file added to the package through an overlay, so the package's directory isn't changed.
+
+Packages that go test reports as having no test files, having all their files excluded by build constraints or having no statements are skipped rather than treated as errors.  Use '-v' to see why a package was skipped.
+
+Test Failures
+
+If any tests fail, roveralls stops and prints a digest for the failing package listing each failing test, the file:line of the failing assertion or panic and the start of its output.  To keep the full go test log of failing packages use:
+
+    roveralls -failure-logs logs
+
+JUnit Test Report
+
+To write a JUnit XML report of the tests from the same run that creates the coverage profile use:
+
+    roveralls -junit junit.xml
+
+Each package is a test suite containing its tests with their durations, failures, skips and output.  With '-matrix' each package has a test suite for each entry, named after the package and entry, such as 'pkg [tags=integration]'.  The report is still written if the tests fail.
+
+Build Configuration Matrix
+
+Code that is only compiled with certain build tags or for a certain architecture can be covered by running the tests under a matrix of configurations.  Each '-matrix' entry is a space separated list of 'tags=tag1,tag2', 'goarch=arch' and 'env=NAME=VALUE' settings, with 'default' being an entry without any settings:
+
+    roveralls -matrix default -matrix 'tags=integration' -matrix 'goarch=386 env=CGO_ENABLED=0'
+
+Every package is tested under each entry and the profiles are merged into one.  The coverage of each entry is output along with the number of statements that were only covered by that entry.
+
+Deterministic Output
+
+The profile is sorted by file and then by position, with exact duplicate lines collapsed, so that it can be diffed between runs.  To also drop blocks without any statements, so that two runs over identical code produce identical files, use:
+
+    roveralls -drop-empty
+
+Merging Profiles
+
+Coverage profiles created separately, such as by CI shards, can be combined into a single profile with the merge subcommand:
+
+    roveralls merge -o roveralls.coverprofile shard1.coverprofile shard2.coverprofile
+
+If no profiles are given, or a profile is '-', it is read from stdin.  The profiles must all start with a mode line and use the same covermode, so that an empty or truncated profile is reported rather than silently adding nothing.  Identical blocks are merged according to the mode: in 'set' mode a block is covered if it is covered in any profile, in 'count' and 'atomic' mode the counts are added together.  The merged profile is sorted by file and position.
+
+Sharding
+
+To split the tests across several CI runners, give each runner a different shard:
+
+    roveralls -shard 1/3 -timings timings1.json,timings2.json,timings3.json
+
+The packages are deterministically partitioned so that every package is tested by exactly one shard.  Each shard writes its profile to 'roveralls.shard-i-of-n.coverprofile' and the duration of each package to 'roveralls.shard-i-of-n.timings.json'.  If timings files from earlier runs are given with '-timings' the packages are balanced across the shards by duration, any packages without a timing are assigned by a hash of their path.  Every shard must be given the same timings files.  Once all the shards have finished their profiles can be combined with the merge subcommand:
+
+    roveralls merge -o roveralls.coverprofile roveralls.shard-*.coverprofile
+
+Integration Coverage
+
+From Go 1.20 binaries built with 'go build -cover' write their coverage data to the directory in the GOCOVERDIR environment variable.  To merge this coverage into the profile from the tests use:
+
+    roveralls -covdata covdir1,covdir2
+
+Alternatively roveralls can build every main package with -cover and run a script against them:
+
+    roveralls -cover-script ./integration-tests.sh
+
+The script is run with 'sh -c' from the working directory.  Each binary is named after its package's directory and put in the same relative directory under ROVERALLS_BINDIR, such as '$ROVERALLS_BINDIR/cmd/foo/foo'.  These directories are also put at the front of PATH, and GOCOVERDIR is set so that the binaries' coverage is collected.
+
+Validating Profiles
+
+To check a coverage profile before uploading it use the validate subcommand:
+
+    roveralls validate roveralls.coverprofile
+
+This checks the mode line, the syntax of each line and that each block ends after it starts.  It reports duplicate and overlapping blocks, and checks that each block is within the source file that it refers to.  Problems are reported with the line number of the profile that they are on.  Use '-skip-source' if the source files aren't available.
+
+Source File Paths
+
+By default the profile refers to source files by their import path, as go test does.  Some tools need filesystem paths instead, which can be output with '-path-style relative', for paths relative to the working directory, or '-path-style absolute'.  The paths are found using go list or GOPATH.  Prefixes of whole directories of the paths can then be replaced with '-path-prefix-map', which may be given more than once:
+
+    roveralls -path-style relative -path-prefix-map internal/=src/internal/
+
+These options can also be given to the merge subcommand.
+
+Keeping Package Output
+
+Normally the output of go test for each package is thrown away once it has been merged.  To keep it use:
+
+    roveralls -outdir roveralls-out
+
+For each package a directory mirroring the package's path is created containing the raw coverage profile, the go test -json output, stderr and a 'result.json' with the exit status and duration.  When more than one '-matrix' entry is given each entry has its own sub-directory.  An 'index.json' at the top of the directory ties each package to its files.
+
+HTML Report
+
+To write a static HTML report that can be viewed offline use:
+
+    roveralls -html coverage-html
+
+The directory contains an 'index.html' with the tree of packages and their coverage, a page for each package listing its files and a page for each file showing its source with the covered and uncovered lines highlighted.  In count and atomic mode the number of times each line was run is also shown.
+
+Function Coverage
+
+To list the coverage of every function, like 'go tool cover -func' does for a single profile, use:
+
+    roveralls -func -
+
+The functions are found by parsing the source files.  Any source file that can't be found or parsed is skipped with a warning.  Each is listed with its file:line, the number of statements covered and its coverage percentage, followed by the total.  Use '-func-sort' to order the functions by file, name, coverage or statements, '-func-min' to only list functions with at least a given coverage and '-func-format json' for a JSON report.
+
+JSON Summary
+
+For dashboards and scripts a JSON summary of the run can be written with:
+
+    roveralls -json-summary summary.json
+
+It contains the total coverage and the number of statements and covered statements of each package and file, along with the duration of the run, the covermode, the go version, the git commit and the flags used.  The 'schemaVersion' field is increased whenever the layout changes in a way that would break its consumers.
+
+SonarQube Report
+
+To write a report in SonarQube's generic test coverage XML format use:
+
+    roveralls -sonar sonar-coverage.xml
+
+The paths of the files in the report are relative to the working directory, or to the project base directory given with '-sonar-base'.  A line with more than one block is reported as having a branch for each block.
+
+Codecov Report
+
+To write a report in Codecov's JSON coverage format, for uploaders that accept it, use:
+
+    roveralls -codecov codecov.json
+
+Each file, relative to the working directory, maps each of its lines to the number of times it was run.  Lines where only some of the blocks on the line were covered are reported as partial, in the form 'covered/blocks'.
+
+Multiple Reports
+
+Any number of reports can be written from a single run with '-report name=dest', which may be given more than once:
+
+    roveralls -report text=roveralls.coverprofile -report html=cov/ -report func=-
+
+The options for single formats, such as '-html', are shorthands for '-report'.  The text profile is written to 'roveralls.coverprofile' unless a text report is requested with '-report', and a destination of '-' writes the report to stdout, except for 'html', which is written to a directory, 'coveralls', which is uploaded, and badges per package.
+
+Uploading to Coveralls
+
+The coverage can be uploaded straight to Coveralls, without installing goveralls, with:
+
+    roveralls -coveralls
+
+The repo token is taken from the COVERALLS_REPO_TOKEN environment variable.  The service name, job id and pull request are taken from the environment variables of GitHub Actions, Travis CI, CircleCI, AppVeyor, GitLab CI or Jenkins and can be overridden with COVERALLS_SERVICE_NAME and COVERALLS_SERVICE_JOB_ID.  The details of the commit and the remotes are taken from the local git repository.  To upload to a different server, such as a self-hosted one, use '-coveralls-endpoint'.
+
+GitHub Actions Annotations
+
+To show the uncovered lines of a pull request inline in GitHub Actions use:
+
+    roveralls -github-annotations -diff-base origin/main
+
+This outputs a '::warning' workflow command for each range of consecutive uncovered lines that were changed since the git ref given with '-diff-base'.  The changes are found from where HEAD branched from that ref, so changes made to it since aren't annotated, and uncommitted changes are included.  If '-diff-base' isn't given it defaults to the pull request's base branch from GITHUB_BASE_REF, and if that isn't set every uncovered line is annotated.  To stop a file from flooding the pull request, at most 10 warnings are output for each file, which can be changed with '-github-annotations-max'.
+
+Markdown Report
+
+To write a Markdown report, suitable for a pull request comment, use:
+
+    roveralls -markdown coverage.md -baseline main.coverprofile -diff-base origin/main
+
+The report has the total coverage, a table of the coverage of each package and a table of the worst covered files.  If a coverage profile is given with '-baseline' the change in coverage of the total and each package is shown.  If '-diff-base' is given, or GITHUB_BASE_REF is set, a collapsible list of the uncovered lines changed since that git ref is included.  When run in GitHub Actions, where GITHUB_STEP_SUMMARY is set, the report is also appended to the job's step summary.
+
+Coverage Badge
+
+To make a coverage badge locally, rather than depending on a badge service, use:
+
+    roveralls -badge coverage.svg
+
+This writes a shields style SVG badge of the total coverage.  Its label can be changed with '-badge-label' and its colour is chosen with '-badge-colours', which gives the colour from each percentage up as a name or hex colour, such as '0:red,80:#4c1'.  With '-badge-per-package' a badge is also written for each top-level package, such as 'coverage-cmd.svg'.
+
+Coverage History
+
+To keep a history of the coverage, append a record of each run to a JSON Lines file with:
+
+    roveralls -history coverage-history.jsonl
+
+Each record holds the time, git commit, total coverage and the coverage of each package.  The trend can then be shown with the 'history' subcommand, which prints a table of the recent runs with sparklines of the total and of each package, along with the packages that moved the total the most in the last run.  Use '-n' to change the number of runs shown and '-html' to also write a page with a chart of the trend:
+
+    roveralls history -n 50 -html trend.html coverage-history.jsonl
+
+SARIF
+
+To report the uncovered code to code scanning tools that read SARIF 2.1.0, use:
+
+    roveralls -sarif coverage.sarif
+
+This writes a result for each uncovered block with its exact region, or with '-sarif-by func' a result for each function that isn't covered at all.  The paths are relative to the top of the git repository.  If '-diff-base' is given, or $GITHUB_BASE_REF is set, only the files changed since that git ref are included so that reviewers see the coverage gaps next to other findings:
+
+    roveralls -sarif coverage.sarif -diff-base origin/master
+
+Listing Uncovered Blocks
+
+To list the uncovered code in a form that editors can jump through, such as Vim's quickfix, Emacs compile-mode or a VS Code problem matcher, use:
+
+    roveralls -list-uncovered
+
+This prints a line such as 'pkg/file.go:12:24: uncovered (3 statements)' for each uncovered block, with the path relative to the working directory.  The list can be narrowed with '-list-uncovered-pkg', which takes a comma separated list of packages where a trailing '/...' also matches the packages below, '-list-uncovered-glob', which matches the paths of the files or their names if the glob has no '/', and '-list-uncovered-min', which skips blocks with fewer statements:
+
+    roveralls -list-uncovered -list-uncovered-glob '*.go' -list-uncovered-min 3
+
 View Output in a Web Browser
 
 To view the code coverage for you package in a browser:
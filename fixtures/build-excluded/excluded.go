@@ -0,0 +1,9 @@
+//go:build roverallsexcluded
+// +build roverallsexcluded
+
+package excluded
+
+// AmIExcluded returns true
+func AmIExcluded() bool {
+	return true
+}
@@ -0,0 +1,14 @@
+//go:build roverallsexcluded
+// +build roverallsexcluded
+
+package excluded
+
+import (
+	"testing"
+)
+
+func TestAmIExcluded(t *testing.T) {
+	if !AmIExcluded() {
+		t.Error("AmIExcluded() got: false, want: true")
+	}
+}
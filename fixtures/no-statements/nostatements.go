@@ -0,0 +1,4 @@
+package nostatements
+
+// Answer is a constant without any statements to cover
+const Answer = 42
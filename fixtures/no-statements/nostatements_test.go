@@ -0,0 +1,11 @@
+package nostatements
+
+import (
+	"testing"
+)
+
+func TestAnswer(t *testing.T) {
+	if Answer != 42 {
+		t.Errorf("Answer got: %d, want: 42", Answer)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build roverallsexcluded
+// +build roverallsexcluded
+
+package testsexcluded
+
+import (
+	"testing"
+)
+
+func TestAreMyTestsExcluded(t *testing.T) {
+	if !AreMyTestsExcluded() {
+		t.Error("AreMyTestsExcluded() got: false, want: true")
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// funcExtent is the position of a function in a source file
+type funcExtent struct {
+	name      string
+	startLine int
+	startCol  int
+	endLine   int
+	endCol    int
+}
+
+// funcCoverage is the coverage of a function
+type funcCoverage struct {
+	File    string  `json:"file"`
+	Line    int     `json:"line"`
+	Name    string  `json:"name"`
+	NumStmt int     `json:"statements"`
+	Covered int     `json:"covered"`
+	Percent float64 `json:"percent"`
+	extent  funcExtent
+}
+
+// funcReport is the JSON form of the function coverage report
+type funcReport struct {
+	Functions []funcCoverage `json:"functions"`
+	NumStmt   int            `json:"statements"`
+	Covered   int            `json:"covered"`
+	Percent   float64        `json:"percent"`
+}
+
+var validFuncSorts = map[string]bool{
+	"file":       true,
+	"name":       true,
+	"coverage":   true,
+	"statements": true,
+}
+
+var validFuncFormats = map[string]bool{"text": true, "json": true}
+
+// findFuncs returns the extent of each function declared in the source
+// file filename
+func findFuncs(filename string) ([]funcExtent, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	funcs := []funcExtent{}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		start := fset.Position(fn.Pos())
+		end := fset.Position(fn.End())
+		funcs = append(funcs, funcExtent{
+			name:      funcName(fn),
+			startLine: start.Line,
+			startCol:  start.Column,
+			endLine:   end.Line,
+			endCol:    end.Column,
+		})
+	}
+	return funcs, nil
+}
+
+// funcName returns the name of fn, prefixed with its receiver's type if
+// it is a method
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	typ := fn.Recv.List[0].Type
+	ptr := ""
+	if star, ok := typ.(*ast.StarExpr); ok {
+		ptr = "*"
+		typ = star.X
+	}
+	switch t := typ.(type) {
+	case *ast.IndexExpr:
+		typ = t.X
+	case *ast.IndexListExpr:
+		typ = t.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		if ptr != "" {
+			return fmt.Sprintf("(*%s).%s", ident.Name, fn.Name.Name)
+		}
+		return ident.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// contains returns true if block b is within the function
+func (fe funcExtent) contains(b profileBlock) bool {
+	if b.startLine < fe.startLine ||
+		(b.startLine == fe.startLine && b.startCol < fe.startCol) {
+		return false
+	}
+	if b.endLine > fe.endLine ||
+		(b.endLine == fe.endLine && b.endCol > fe.endCol) {
+		return false
+	}
+	return true
+}
+
+// funcCoverages returns the coverage of every function in the files of
+// summary.  Files whose source can't be found or parsed are skipped with a
+// warning written to warn.
+func funcCoverages(
+	summary *coverageSummary,
+	resolver *pathResolver,
+	warn io.Writer,
+) []funcCoverage {
+	r := []funcCoverage{}
+	for _, f := range summary.files {
+		filename, err := resolver.resolve(f.file)
+		if err != nil {
+			fmt.Fprintf(warn, "warning: skipping functions of: %s, %s\n", f.file, err)
+			continue
+		}
+		extents, err := findFuncs(filename)
+		if err != nil {
+			fmt.Fprintf(warn, "warning: skipping functions of: %s, %s\n", f.file, err)
+			continue
+		}
+		for _, fe := range extents {
+			fc := funcCoverage{
+				File:   f.file,
+				Line:   fe.startLine,
+				Name:   fe.name,
+				extent: fe,
+			}
+			for _, b := range f.blocks {
+				if !fe.contains(b) {
+					continue
+				}
+				fc.NumStmt += b.numStmt
+				if b.count > 0 {
+					fc.Covered += b.numStmt
+				}
+			}
+			fc.Percent = percent(fc.Covered, fc.NumStmt)
+			r = append(r, fc)
+		}
+	}
+	return r
+}
+
+// sortFuncs sorts funcs by file and line, name, coverage with the least
+// covered first or statements with the most statements first
+func sortFuncs(funcs []funcCoverage, by string) {
+	byFile := func(i, j int) bool {
+		if funcs[i].File != funcs[j].File {
+			return funcs[i].File < funcs[j].File
+		}
+		return funcs[i].Line < funcs[j].Line
+	}
+	less := byFile
+	switch by {
+	case "name":
+		less = func(i, j int) bool {
+			if funcs[i].Name != funcs[j].Name {
+				return funcs[i].Name < funcs[j].Name
+			}
+			return byFile(i, j)
+		}
+	case "coverage":
+		less = func(i, j int) bool {
+			if funcs[i].Percent != funcs[j].Percent {
+				return funcs[i].Percent < funcs[j].Percent
+			}
+			return byFile(i, j)
+		}
+	case "statements":
+		less = func(i, j int) bool {
+			if funcs[i].NumStmt != funcs[j].NumStmt {
+				return funcs[i].NumStmt > funcs[j].NumStmt
+			}
+			return byFile(i, j)
+		}
+	}
+	sort.SliceStable(funcs, less)
+}
+
+// filterFuncs returns the functions in funcs with at least minCoverage
+// percent coverage
+func filterFuncs(funcs []funcCoverage, minCoverage float64) []funcCoverage {
+	r := []funcCoverage{}
+	for _, fc := range funcs {
+		if fc.Percent >= minCoverage {
+			r = append(r, fc)
+		}
+	}
+	return r
+}
+
+// writeFuncReport writes funcs to w in format text or json, along with
+// the total coverage of the profile
+func writeFuncReport(
+	w io.Writer,
+	funcs []funcCoverage,
+	summary *coverageSummary,
+	format string,
+) error {
+	if format == "json" {
+		b, err := json.MarshalIndent(funcReport{
+			Functions: funcs,
+			NumStmt:   summary.numStmt,
+			Covered:   summary.covered,
+			Percent:   summary.percent(),
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
+	for _, fc := range funcs {
+		fmt.Fprintf(tw, "%s:%d:\t%s\t%d/%d\t%.1f%%\n",
+			fc.File, fc.Line, fc.Name, fc.Covered, fc.NumStmt, fc.Percent)
+	}
+	fmt.Fprintf(tw, "total:\t(statements)\t%d/%d\t%.1f%%\n",
+		summary.covered, summary.numStmt, summary.percent())
+	return tw.Flush()
+}
+
+// funcReporter writes the function coverage report to filename, with '-'
+// meaning stdout
+type funcReporter struct {
+	filename    string
+	sortBy      string
+	format      string
+	minCoverage float64
+}
+
+func (r funcReporter) Report(prof *profile, run *runInfo) error {
+	summary := summarize(prof)
+	funcs := funcCoverages(summary, run.resolver, run.outErr)
+	sortFuncs(funcs, r.sortBy)
+	funcs = filterFuncs(funcs, r.minCoverage)
+	return writeReportFile(r.filename, run.out, func(w io.Writer) error {
+		return writeFuncReport(w, funcs, summary, r.format)
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindFuncs(t *testing.T) {
+	got, err := findFuncs(filepath.Join("testdata", "funcs", "funcs.go"))
+	if err != nil {
+		t.Fatalf("findFuncs err: %s", err)
+	}
+	want := []funcExtent{
+		{name: "(*T).Method", startLine: 5, startCol: 1, endLine: 10, endCol: 2},
+		{name: "T.Value", startLine: 12, startCol: 1, endLine: 14, endCol: 2},
+		{name: "Plain", startLine: 16, startCol: 1, endLine: 18, endCol: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findFuncs got: %v, want: %v", got, want)
+	}
+}
+
+func funcsProfile() *profile {
+	file := "testdata/funcs/funcs.go"
+	return &profile{mode: "count", blocks: []profileBlock{
+		{file: file, startLine: 5, startCol: 31, endLine: 6, endCol: 11, numStmt: 1, count: 2},
+		{file: file, startLine: 9, startCol: 2, endLine: 9, endCol: 10, numStmt: 1, count: 0},
+		{file: file, startLine: 6, startCol: 11, endLine: 8, endCol: 3, numStmt: 1, count: 2},
+		{file: file, startLine: 12, startCol: 24, endLine: 14, endCol: 2, numStmt: 1, count: 0},
+		{file: file, startLine: 16, startCol: 18, endLine: 18, endCol: 2, numStmt: 1, count: 1},
+	}}
+}
+
+func TestFuncCoverages(t *testing.T) {
+	prof := funcsProfile()
+	prof.blocks = append(prof.blocks, profileBlock{
+		file: "example.com/nonexistant/a.go", startLine: 1, startCol: 1,
+		endLine: 2, endCol: 1, numStmt: 1, count: 1,
+	})
+	var gotWarn bytes.Buffer
+	got := funcCoverages(summarize(prof), newPathResolver(), &gotWarn)
+	wantWarn := "warning: skipping functions of: example.com/nonexistant/a.go, " +
+		"can't find source file for: example.com/nonexistant/a.go\n"
+	if gotWarn.String() != wantWarn {
+		t.Errorf("funcCoverages gotWarn: %s, want: %s", gotWarn.String(), wantWarn)
+	}
+	file := "testdata/funcs/funcs.go"
+	want := []funcCoverage{
+		{File: file, Line: 5, Name: "(*T).Method", NumStmt: 3, Covered: 2,
+			Percent: 200.0 / 3,
+			extent:  funcExtent{"(*T).Method", 5, 1, 10, 2}},
+		{File: file, Line: 12, Name: "T.Value", NumStmt: 1, Covered: 0,
+			extent: funcExtent{"T.Value", 12, 1, 14, 2}},
+		{File: file, Line: 16, Name: "Plain", NumStmt: 1, Covered: 1,
+			Percent: 100,
+			extent:  funcExtent{"Plain", 16, 1, 18, 2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("funcCoverages got: %v, want: %v", got, want)
+	}
+}
+
+func TestSortFuncs(t *testing.T) {
+	funcs := []funcCoverage{
+		{File: "b.go", Line: 1, Name: "A", NumStmt: 2, Percent: 50},
+		{File: "a.go", Line: 9, Name: "C", NumStmt: 1, Percent: 100},
+		{File: "a.go", Line: 3, Name: "B", NumStmt: 4, Percent: 0},
+	}
+	cases := []struct {
+		by   string
+		want []string
+	}{
+		{by: "file", want: []string{"B", "C", "A"}},
+		{by: "name", want: []string{"A", "B", "C"}},
+		{by: "coverage", want: []string{"B", "A", "C"}},
+		{by: "statements", want: []string{"B", "A", "C"}},
+	}
+	for _, c := range cases {
+		sortFuncs(funcs, c.by)
+		got := []string{}
+		for _, fc := range funcs {
+			got = append(got, fc.Name)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("sortFuncs(%s) got: %v, want: %v", c.by, got, c.want)
+		}
+	}
+}
+
+func TestWriteFuncReport(t *testing.T) {
+	prof := funcsProfile()
+	summary := summarize(prof)
+	funcs := funcCoverages(summary, newPathResolver(), ioutil.Discard)
+	funcs = filterFuncs(funcs, 50)
+
+	var text bytes.Buffer
+	if err := writeFuncReport(&text, funcs, summary, "text"); err != nil {
+		t.Fatalf("writeFuncReport err: %s", err)
+	}
+	wantText := "testdata/funcs/funcs.go:5:\t(*T).Method\t2/3\t66.7%\n" +
+		"testdata/funcs/funcs.go:16:\tPlain\t\t1/1\t100.0%\n" +
+		"total:\t\t\t\t(statements)\t3/5\t60.0%\n"
+	if text.String() != wantText {
+		t.Errorf("writeFuncReport got: %q, want: %q", text.String(), wantText)
+	}
+
+	var js bytes.Buffer
+	if err := writeFuncReport(&js, funcs, summary, "json"); err != nil {
+		t.Fatalf("writeFuncReport err: %s", err)
+	}
+	got := funcReport{}
+	if err := json.Unmarshal(js.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal err: %s", err)
+	}
+	if len(got.Functions) != 2 || got.NumStmt != 5 || got.Covered != 3 {
+		t.Errorf("writeFuncReport got: %v", got)
+	}
+}
+
+func TestRun_func(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{os.Args[0], "-func", "-"}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir(filepath.Join("fixtures", "good")); err != nil {
+		t.Fatalf("ChDir err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+	want := "github.com/lawrencewoodman/roveralls/fixtures/good/good.go:4:\tAmIGood\t\t1/1\t100.0%\n"
+	if !bytes.Contains(gotOut.Bytes(), []byte(want)) {
+		t.Errorf("Run: gotOut: %s, want: %s", gotOut.String(), want)
+	}
+}
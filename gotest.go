@@ -0,0 +1,301 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// testEvent is an event output by go test -json.  Matrix is the -matrix
+// entry that the tests were run under, if -matrix was given.
+type testEvent struct {
+	Time       time.Time
+	Action     string
+	Package    string
+	ImportPath string
+	Test       string
+	Elapsed    float64
+	Output     string
+	Matrix     string `json:"-"`
+}
+
+// testFailure describes a test that failed or panicked
+type testFailure struct {
+	test     string
+	output   []string
+	location string
+	panicked bool
+}
+
+// goTestOutcome is the classification of the result of running go test
+// on a package
+type goTestOutcome int
+
+const (
+	testsPassed goTestOutcome = iota
+	noTestFiles
+	constraintsExcluded
+	noStatements
+	testsFailed
+)
+
+var (
+	// From Go 1.22 a package without test files is reported with its
+	// coverage rather than as having no test files
+	untestedCoverageRegexp = regexp.MustCompile(`^\t\S+\t+coverage: `)
+	noStatementsRegexp     = regexp.MustCompile(
+		`(^|\t)coverage: \[no statements\]`,
+	)
+)
+
+const constraintsExcludedMsg = "build constraints exclude all Go files"
+
+// classifyGoTest works out the outcome of a go test run from whether it
+// returned an error, the events that go test -json output for the package
+// itself, rather than its tests or dependencies, and what it wrote to
+// stderr.  The output of the tests is ignored
+// so that what they log can't be mistaken for the package's result.
+func classifyGoTest(
+	runErr error,
+	events []testEvent,
+	stderr string,
+) goTestOutcome {
+	pkg := ""
+	for _, e := range events {
+		if e.Action == "start" {
+			pkg = e.Package
+			break
+		}
+	}
+	action := ""
+	output := []string{}
+	for _, e := range events {
+		if e.Test != "" || (pkg != "" && e.Package != pkg) {
+			continue
+		}
+		switch e.Action {
+		case "output", "build-output":
+			output = append(output, strings.TrimSuffix(e.Output, "\n"))
+		case "pass", "skip", "fail":
+			action = e.Action
+		}
+	}
+	hasOutput := func(substr string) bool {
+		for _, line := range output {
+			if strings.Contains(line, substr) {
+				return true
+			}
+		}
+		return false
+	}
+	matchOutput := func(re *regexp.Regexp) bool {
+		for _, line := range output {
+			if re.MatchString(line) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch action {
+	case "skip":
+		return noTestFiles
+	case "pass":
+		if runErr != nil {
+			return testsFailed
+		}
+		switch {
+		case matchOutput(untestedCoverageRegexp):
+			return noTestFiles
+		case matchOutput(noStatementsRegexp):
+			return noStatements
+		}
+		return testsPassed
+	}
+	// Before Go 1.24 build errors are written to stderr rather than as
+	// events and no event may be output for the package
+	if hasOutput(constraintsExcludedMsg) ||
+		strings.Contains(stderr, constraintsExcludedMsg) {
+		return constraintsExcluded
+	}
+	if runErr != nil || action == "fail" {
+		return testsFailed
+	}
+	return testsPassed
+}
+
+// isSkip returns true if the package should be skipped rather than having
+// its coverage included or being treated as an error
+func (o goTestOutcome) isSkip() bool {
+	return o == noTestFiles || o == constraintsExcluded || o == noStatements
+}
+
+func (o goTestOutcome) String() string {
+	switch o {
+	case testsPassed:
+		return "tests passed"
+	case noTestFiles:
+		return "no test files"
+	case constraintsExcluded:
+		return "build constraints exclude all Go files"
+	case noStatements:
+		return "no statements"
+	case testsFailed:
+		return "tests failed"
+	}
+	return "unknown outcome"
+}
+
+// parseTestEvents parses the output of go test -json.  It returns the events
+// and the plain text output that go test would have produced without -json.
+// Any lines that aren't JSON events are passed through to the text output.
+func parseTestEvents(out []byte) ([]testEvent, string) {
+	var events []testEvent
+	var text bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var e testEvent
+		if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &e) != nil {
+			text.Write(line)
+			text.WriteByte('\n')
+			continue
+		}
+		if e.Package == "" {
+			e.Package = e.ImportPath
+		}
+		events = append(events, e)
+		text.WriteString(e.Output)
+	}
+	return events, text.String()
+}
+
+// eventsPackage returns the package that the events relate to
+func eventsPackage(events []testEvent) string {
+	for _, e := range events {
+		if e.Package != "" {
+			return e.Package
+		}
+	}
+	return ""
+}
+
+var (
+	assertLocationRegexp = regexp.MustCompile(`^\s+(\S+\.go:\d+): `)
+	stackLocationRegexp  = regexp.MustCompile(`^\s+(\S+\.go:\d+)( \+0x[0-9a-f]+)?$`)
+	testFrameRegexp      = regexp.MustCompile(`^(=== (RUN|PAUSE|CONT|NAME)|--- (PASS|FAIL|SKIP)):? `)
+)
+
+// findTestFailures returns the failing tests in the order that they failed.
+// A test that only failed because one of its subtests failed isn't included.
+func findTestFailures(events []testEvent) []testFailure {
+	outputs := map[string][]string{}
+	failures := []testFailure{}
+	for _, e := range events {
+		if e.Test == "" {
+			continue
+		}
+		switch e.Action {
+		case "output":
+			if !testFrameRegexp.MatchString(e.Output) {
+				outputs[e.Test] = append(outputs[e.Test],
+					strings.TrimSuffix(e.Output, "\n"))
+			}
+		case "fail":
+			failures = append(failures, makeTestFailure(e.Test, outputs[e.Test]))
+		}
+	}
+
+	isParent := map[string]bool{}
+	for _, f := range failures {
+		if i := strings.LastIndex(f.test, "/"); i >= 0 {
+			isParent[f.test[:i]] = true
+		}
+	}
+	r := make([]testFailure, 0, len(failures))
+	for _, f := range failures {
+		if !isParent[f.test] {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+func makeTestFailure(test string, output []string) testFailure {
+	f := testFailure{test: test, output: output}
+	for _, line := range output {
+		if strings.HasPrefix(line, "panic: ") {
+			f.panicked = true
+			break
+		}
+	}
+	if f.panicked {
+		f.location = panicLocation(output)
+		return f
+	}
+	for _, line := range output {
+		if m := assertLocationRegexp.FindStringSubmatch(line); m != nil {
+			f.location = m[1]
+			break
+		}
+	}
+	return f
+}
+
+// panicLocation returns the first location in the stack trace of a panic
+// that isn't in the runtime or testing packages
+func panicLocation(output []string) string {
+	for _, line := range output {
+		m := stackLocationRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		loc := m[1]
+		if strings.Contains(loc, "/src/runtime/") ||
+			strings.Contains(loc, "/src/testing/") {
+			continue
+		}
+		return loc
+	}
+	return ""
+}
+
+// digest returns a summary of the failure with at most maxLines of output
+func (f testFailure) digest(maxLines int) string {
+	var b bytes.Buffer
+	kind := "FAIL"
+	if f.panicked {
+		kind = "PANIC"
+	}
+	if f.location == "" {
+		fmt.Fprintf(&b, "--- %s: %s\n", kind, f.test)
+	} else {
+		fmt.Fprintf(&b, "--- %s: %s at %s\n", kind, f.test, f.location)
+	}
+	lines := f.output
+	if f.panicked {
+		lines = []string{}
+		for _, line := range f.output {
+			if strings.HasPrefix(line, "panic: ") {
+				lines = append(lines, line)
+				break
+			}
+		}
+	}
+	for i, line := range lines {
+		if i == maxLines {
+			fmt.Fprintf(&b, "    ... %d more lines\n", len(lines)-maxLines)
+			break
+		}
+		fmt.Fprintf(&b, "    %s\n", strings.TrimSpace(line))
+	}
+	return b.String()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestClassifyGoTest(t *testing.T) {
+	pkgEvents := func(action string, output ...string) []testEvent {
+		events := []testEvent{{Action: "start", Package: "pkg"}}
+		for _, o := range output {
+			events = append(events, testEvent{Action: "output", Package: "pkg", Output: o})
+		}
+		if action != "" {
+			events = append(events, testEvent{Action: action, Package: "pkg"})
+		}
+		return events
+	}
+	testOutput := func(events []testEvent, output string) []testEvent {
+		e := testEvent{Action: "output", Package: "pkg", Test: "TestA", Output: output}
+		return append([]testEvent{events[0], e}, events[1:]...)
+	}
+	cases := []struct {
+		runErr error
+		events []testEvent
+		stderr string
+		want   goTestOutcome
+	}{
+		{events: pkgEvents("pass", "PASS\n", "coverage: 100.0% of statements\n",
+			"ok  \tpkg\t0.002s\n"),
+			want: testsPassed,
+		},
+		{events: pkgEvents("skip", "?   \tpkg\t[no test files]\n"),
+			want: noTestFiles,
+		},
+		{events: pkgEvents("pass", "\tpkg\t\tcoverage: 0.0% of statements\n"),
+			want: noTestFiles,
+		},
+		{events: pkgEvents("pass", "PASS\n", "coverage: [no statements]\n",
+			"ok  \tpkg\t0.002s\n"),
+			want: noStatements,
+		},
+		{events: pkgEvents("pass",
+			"ok  \tpkg\t0.002s\tcoverage: [no statements]\n"),
+			want: noStatements,
+		},
+		// What the tests log mustn't change the outcome
+		{events: testOutput(pkgEvents("pass", "PASS\n",
+			"coverage: 100.0% of statements\n", "ok  \tpkg\t0.002s\n"),
+			"    pkg_test.go:8: coverage:  1\n"),
+			want: testsPassed,
+		},
+		{events: testOutput(pkgEvents("pass", "PASS\n",
+			"coverage: 100.0% of statements\n", "ok  \tpkg\t0.002s\n"),
+			"    pkg_test.go:8: coverage: [no statements]\n"),
+			want: testsPassed,
+		},
+		{runErr: errors.New("exit status 1"),
+			events: testOutput(pkgEvents("fail", "FAIL\n"),
+				"    pkg_test.go:8: build constraints exclude all Go files\n"),
+			want: testsFailed,
+		},
+		{runErr: errors.New("exit status 1"),
+			events: append([]testEvent{{Action: "build-output", Package: "pkg",
+				Output: "package pkg: build constraints exclude all Go files in /tmp/pkg\n"}},
+				pkgEvents("fail", "FAIL\tpkg [setup failed]\n")...),
+			want: constraintsExcluded,
+		},
+		{runErr: errors.New("exit status 1"),
+			stderr: "package excluded: build constraints exclude all Go files in /tmp/excluded\n",
+			want:   constraintsExcluded,
+		},
+		{runErr: errors.New("exit status 1"),
+			events: testOutput(pkgEvents("fail", "FAIL\n"),
+				"--- FAIL: TestA (0.00s)\n"),
+			want: testsFailed,
+		},
+	}
+	for i, c := range cases {
+		got := classifyGoTest(c.runErr, c.events, c.stderr)
+		if got != c.want {
+			t.Errorf("(%d) classifyGoTest got: %s, want: %s", i, got, c.want)
+		}
+	}
+}
+
+func TestGoTestOutcomeIsSkip(t *testing.T) {
+	cases := []struct {
+		outcome goTestOutcome
+		want    bool
+	}{
+		{outcome: testsPassed, want: false},
+		{outcome: noTestFiles, want: true},
+		{outcome: constraintsExcluded, want: true},
+		{outcome: noStatements, want: true},
+		{outcome: testsFailed, want: false},
+	}
+	for _, c := range cases {
+		got := c.outcome.isSkip()
+		if got != c.want {
+			t.Errorf("isSkip(%s) got: %t, want: %t", c.outcome, got, c.want)
+		}
+	}
+}
+
+func TestParseTestEvents(t *testing.T) {
+	out := []byte(`# example.com/pkg
+{"Action":"start","Package":"example.com/pkg"}
+{"Action":"output","Package":"example.com/pkg","Test":"TestA","Output":"=== RUN   TestA\n"}
+{"Action":"pass","Package":"example.com/pkg","Test":"TestA","Elapsed":0.5}
+{"Action":"output","Package":"example.com/pkg","Output":"PASS\n"}
+{"ImportPath":"example.com/other","Action":"build-output","Output":"built\n"}
+`)
+	events, text := parseTestEvents(out)
+	wantText := "# example.com/pkg\n=== RUN   TestA\nPASS\nbuilt\n"
+	if text != wantText {
+		t.Errorf("parseTestEvents got text: %q, want: %q", text, wantText)
+	}
+	if len(events) != 5 {
+		t.Fatalf("parseTestEvents got %d events, want: 5", len(events))
+	}
+	if events[2].Elapsed != 0.5 || events[2].Test != "TestA" {
+		t.Errorf("parseTestEvents got event: %v", events[2])
+	}
+	if events[4].Package != "example.com/other" {
+		t.Errorf("parseTestEvents got package: %s, want: example.com/other",
+			events[4].Package)
+	}
+}
+
+func TestFindTestFailures(t *testing.T) {
+	events := []testEvent{
+		{Action: "output", Test: "TestA", Output: "=== RUN   TestA\n"},
+		{Action: "output", Test: "TestA/sub", Output: "=== RUN   TestA/sub\n"},
+		{Action: "output", Test: "TestA/sub", Output: "    a_test.go:12: bad\n"},
+		{Action: "output", Test: "TestA/sub", Output: "--- FAIL: TestA/sub (0.00s)\n"},
+		{Action: "fail", Test: "TestA/sub"},
+		{Action: "output", Test: "TestA", Output: "--- FAIL: TestA (0.00s)\n"},
+		{Action: "fail", Test: "TestA"},
+		{Action: "output", Test: "TestB", Output: "panic: oops\n"},
+		{Action: "output", Test: "TestB", Output: "\t/usr/local/go/src/testing/testing.go:2123 +0x232\n"},
+		{Action: "output", Test: "TestB", Output: "\t/src/pkg/b_test.go:20 +0x28\n"},
+		{Action: "fail", Test: "TestB"},
+		{Action: "pass", Test: "TestC"},
+	}
+	want := []testFailure{
+		{test: "TestA/sub",
+			output:   []string{"    a_test.go:12: bad"},
+			location: "a_test.go:12",
+		},
+		{test: "TestB",
+			output: []string{
+				"panic: oops",
+				"\t/usr/local/go/src/testing/testing.go:2123 +0x232",
+				"\t/src/pkg/b_test.go:20 +0x28",
+			},
+			location: "/src/pkg/b_test.go:20",
+			panicked: true,
+		},
+	}
+	got := findTestFailures(events)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findTestFailures got: %v, want: %v", got, want)
+	}
+}
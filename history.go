@@ -0,0 +1,435 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// historyMovers is the number of packages listed as having moved the
+// total coverage the most
+const historyMovers = 5
+
+// historyRecord is the coverage of a run in a history file
+type historyRecord struct {
+	Time     time.Time               `json:"time"`
+	Commit   string                  `json:"commit"`
+	Total    jsonCoverage            `json:"total"`
+	Packages map[string]jsonCoverage `json:"packages"`
+}
+
+// historyReporter appends a record of the coverage to a history file
+type historyReporter struct {
+	filename string
+	now      func() time.Time
+}
+
+// packageMove is how much a package moved the total coverage between runs
+type packageMove struct {
+	pkg   string
+	delta float64
+}
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+func makeHistoryRecord(prof *profile, now time.Time, commit string) historyRecord {
+	summary := summarize(prof)
+	r := historyRecord{
+		Time:     now.UTC(),
+		Commit:   commit,
+		Total:    makeJSONCoverage(summary.numStmt, summary.covered),
+		Packages: map[string]jsonCoverage{},
+	}
+	for _, pc := range summary.packages {
+		r.Packages[pc.pkg] = makeJSONCoverage(pc.numStmt, pc.covered)
+	}
+	return r
+}
+
+// appendHistory appends record to the history file filename, or writes
+// it to out if filename is '-'
+func appendHistory(filename string, out io.Writer, record historyRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if filename == "-" {
+		_, err := out.Write(append(b, '\n'))
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	return f.Close()
+}
+
+// readHistory reads the records from a history file
+func readHistory(r io.Reader) ([]historyRecord, error) {
+	records := []historyRecord{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record historyRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func (r historyReporter) Report(prof *profile, run *runInfo) error {
+	record := makeHistoryRecord(prof, r.now(), gitCommit())
+	return appendHistory(r.filename, run.out, record)
+}
+
+// sparkline returns a line of blocks representing values scaled between
+// their minimum and maximum.  NaN values are shown as spaces.
+func sparkline(values []float64) string {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+		}
+	}
+	r := make([]rune, len(values))
+	for i, v := range values {
+		switch {
+		case math.IsNaN(v):
+			r[i] = ' '
+		case max == min:
+			r[i] = sparkChars[len(sparkChars)/2]
+		default:
+			r[i] = sparkChars[int((v-min)/(max-min)*float64(len(sparkChars)-1)+0.5)]
+		}
+	}
+	return string(r)
+}
+
+// historyPackages returns the names of all the packages in records in order
+func historyPackages(records []historyRecord) []string {
+	seen := map[string]bool{}
+	pkgs := []string{}
+	for _, r := range records {
+		for pkg := range r.Packages {
+			if !seen[pkg] {
+				seen[pkg] = true
+				pkgs = append(pkgs, pkg)
+			}
+		}
+	}
+	sort.Strings(pkgs)
+	return pkgs
+}
+
+// packagePercents returns the coverage of pkg in each record, with NaN
+// where it isn't in a record
+func packagePercents(records []historyRecord, pkg string) []float64 {
+	r := make([]float64, len(records))
+	for i, record := range records {
+		if c, ok := record.Packages[pkg]; ok {
+			r[i] = c.Percent
+		} else {
+			r[i] = math.NaN()
+		}
+	}
+	return r
+}
+
+// packageMoves returns how much each package moved the total coverage
+// between prev and last, in percentage points, with the biggest moves
+// first.  A package's move is the statements it covered less those it
+// would have had to cover to keep the previous total coverage, so that
+// adding uncovered statements counts against it.  The moves of all the
+// packages add up to the change in the total.
+func packageMoves(prev historyRecord, last historyRecord) []packageMove {
+	moves := []packageMove{}
+	if last.Total.NumStmt == 0 {
+		return moves
+	}
+	prevFraction := percent(prev.Total.Covered, prev.Total.NumStmt) / 100
+	for _, pkg := range historyPackages([]historyRecord{prev, last}) {
+		covered := last.Packages[pkg].Covered - prev.Packages[pkg].Covered
+		numStmt := last.Packages[pkg].NumStmt - prev.Packages[pkg].NumStmt
+		delta := 100 * (float64(covered) - prevFraction*float64(numStmt)) /
+			float64(last.Total.NumStmt)
+		if delta != 0 {
+			moves = append(moves, packageMove{pkg: pkg, delta: delta})
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		return math.Abs(moves[i].delta) > math.Abs(moves[j].delta)
+	})
+	return moves
+}
+
+// writeHistoryReport writes tables of the trend of the total coverage and
+// the coverage of each package, along with the packages that moved the
+// total the most in the last run
+func writeHistoryReport(w io.Writer, records []historyRecord) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(w, "No coverage history")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Coverage history (%d runs):\n", len(records))
+	totals := make([]float64, len(records))
+	for i, r := range records {
+		totals[i] = r.Total.Percent
+		fmt.Fprintf(tw, "  %s\t%s\t%.1f%%",
+			r.Time.Format("2006-01-02 15:04"), shortCommit(r.Commit),
+			r.Total.Percent)
+		if i > 0 {
+			fmt.Fprintf(tw, "\t%s",
+				formatDelta(r.Total.Percent-records[i-1].Total.Percent))
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+	first, last := records[0], records[len(records)-1]
+	fmt.Fprintf(tw, "\nTotal:\t%s\t%.1f%%\t%.1f%%\t%s\n",
+		sparkline(totals), first.Total.Percent, last.Total.Percent,
+		formatDelta(last.Total.Percent-first.Total.Percent))
+	fmt.Fprintf(tw, "\nPackages:\n")
+	for _, pkg := range historyPackages(records) {
+		percents := packagePercents(records, pkg)
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", pkg, sparkline(percents),
+			formatPercent(percents[0]), formatPercent(percents[len(percents)-1]),
+			formatChange(percents[0], percents[len(percents)-1]))
+	}
+	if len(records) > 1 {
+		moves := packageMoves(records[len(records)-2], last)
+		if len(moves) > 0 {
+			fmt.Fprintf(tw, "\nBiggest movers of the total in the last run:\n")
+			if len(moves) > historyMovers {
+				moves = moves[:historyMovers]
+			}
+			for _, m := range moves {
+				fmt.Fprintf(tw, "  %s\t%s\n", m.pkg, formatDelta(m.delta))
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func shortCommit(commit string) string {
+	switch {
+	case commit == "":
+		return "-"
+	case len(commit) > 7:
+		return commit[:7]
+	}
+	return commit
+}
+
+func formatPercent(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", v)
+}
+
+func formatChange(first float64, last float64) string {
+	switch {
+	case math.IsNaN(last):
+		return "removed"
+	case math.IsNaN(first):
+		return "new"
+	}
+	return formatDelta(last - first)
+}
+
+// historyChart is the data passed to the HTML trend chart template
+type historyChart struct {
+	Width   int
+	Height  int
+	Lines   []historyChartLine
+	Records []historyRecord
+}
+
+// historyChartLine is a line on the HTML trend chart
+type historyChartLine struct {
+	Name   string
+	Colour string
+	Points string
+	Width  float64
+}
+
+var historyChartColours = []string{
+	"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd",
+}
+
+// chartPoints returns the points of an SVG polyline plotting percents,
+// skipping NaN values
+func chartPoints(percents []float64, width int, height int) string {
+	var b bytes.Buffer
+	step := 0.0
+	if len(percents) > 1 {
+		step = float64(width) / float64(len(percents)-1)
+	}
+	for i, v := range percents {
+		if math.IsNaN(v) {
+			continue
+		}
+		fmt.Fprintf(&b, "%.1f,%.1f ", float64(i)*step, float64(height)*(1-v/100))
+	}
+	return string(bytes.TrimSpace(b.Bytes()))
+}
+
+// writeHistoryHTML writes an HTML page with a chart of the total coverage
+// and the coverage of the packages that moved it the most over the records
+func writeHistoryHTML(w io.Writer, records []historyRecord) error {
+	chart := historyChart{Width: 800, Height: 300, Records: records}
+	totals := make([]float64, len(records))
+	for i, r := range records {
+		totals[i] = r.Total.Percent
+	}
+	chart.Lines = append(chart.Lines, historyChartLine{
+		Name:   "Total",
+		Colour: "#000",
+		Points: chartPoints(totals, chart.Width, chart.Height),
+		Width:  3,
+	})
+	if len(records) > 1 {
+		moves := packageMoves(records[0], records[len(records)-1])
+		if len(moves) > historyMovers {
+			moves = moves[:historyMovers]
+		}
+		for i, m := range moves {
+			chart.Lines = append(chart.Lines, historyChartLine{
+				Name:   m.pkg,
+				Colour: historyChartColours[i%len(historyChartColours)],
+				Points: chartPoints(packagePercents(records, m.pkg),
+					chart.Width, chart.Height),
+				Width: 1.5,
+			})
+		}
+	}
+	return historyTemplate.Execute(w, chart)
+}
+
+func (p *Program) historyUsageMsg(fs *flag.FlagSet) string {
+	var b bytes.Buffer
+	const desc = `
+roveralls history shows the trend of the coverage recorded in a history
+file written with -history, including which packages moved the total
+coverage the most in the last run.
+`
+	fmt.Fprintf(&b, "%s\n", desc)
+	fmt.Fprintf(&b, "Usage: roveralls history [-n runs] [-html filename] history.jsonl\n")
+	fs.SetOutput(&b)
+	fs.PrintDefaults()
+	fs.SetOutput(p.outErr)
+	return b.String()
+}
+
+// runHistory runs the history subcommand
+func (p *Program) runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(p.outErr)
+	fs.IntVar(&p.historyRuns, "n", 20, "Only show the last `runs` runs, 0 for all")
+	fs.StringVar(
+		&p.historyHTML,
+		"html",
+		"",
+		"Write an HTML trend chart to `filename`",
+	)
+	fs.BoolVar(&p.help, "help", false, "Display this help")
+	fs.Usage = func() {
+		fmt.Fprint(p.outErr, p.historyUsageMsg(fs))
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if p.help {
+		fmt.Fprint(p.out, p.historyUsageMsg(fs))
+		return 0
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(p.outErr, "a single history file must be given")
+		fmt.Fprint(p.outErr, p.historyUsageMsg(fs))
+		return 1
+	}
+
+	filename := fs.Arg(0)
+	f, err := os.Open(filename)
+	if err != nil {
+		fmt.Fprintf(p.outErr, "%s\n", err)
+		return 1
+	}
+	records, err := readHistory(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(p.outErr, "error reading: %s, %s\n", filename, err)
+		return 1
+	}
+	if p.historyRuns > 0 && len(records) > p.historyRuns {
+		records = records[len(records)-p.historyRuns:]
+	}
+	if err := writeHistoryReport(p.out, records); err != nil {
+		fmt.Fprintf(p.outErr, "%s\n", err)
+		return 1
+	}
+	if p.historyHTML != "" {
+		err := writeReportFile(p.historyHTML, p.out, func(w io.Writer) error {
+			return writeHistoryHTML(w, records)
+		})
+		if err != nil {
+			fmt.Fprintf(p.outErr, "%s\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+var historyTemplate = template.Must(template.New("history").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage History</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+svg { border: 1px solid #ddd; overflow: visible; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { padding: 0.2em 0.5em; text-align: left; }
+td.num { text-align: right; }
+.key { display: inline-block; width: 1em; height: 0.3em; vertical-align: middle; }
+</style>
+</head>
+<body>
+<h1>Coverage History</h1>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+<line x1="0" y1="{{.Height}}" x2="{{.Width}}" y2="{{.Height}}" stroke="#ddd"/>
+{{range .Lines}}<polyline fill="none" stroke="{{.Colour}}" stroke-width="{{.Width}}" points="{{.Points}}"><title>{{.Name}}</title></polyline>
+{{end}}</svg>
+<p>{{range .Lines}}<span class="key" style="background: {{.Colour}}"></span> {{.Name}} &nbsp; {{end}}</p>
+<table>
+<tr><th>Time</th><th>Commit</th><th>Coverage</th><th>Statements</th></tr>
+{{range .Records}}<tr><td>{{.Time.Format "2006-01-02 15:04"}}</td><td>{{.Commit}}</td><td class="num">{{printf "%.1f%%" .Total.Percent}}</td><td class="num">{{.Total.Covered}}/{{.Total.NumStmt}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
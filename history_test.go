@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	cases := []struct {
+		values []float64
+		want   string
+	}{
+		{values: []float64{}, want: ""},
+		{values: []float64{50, 50}, want: "▅▅"},
+		{values: []float64{0, 50, 100}, want: "▁▅█"},
+		{values: []float64{math.NaN(), 10, 20}, want: " ▁█"},
+	}
+	for _, c := range cases {
+		got := sparkline(c.values)
+		if got != c.want {
+			t.Errorf("sparkline(%v) got: %s, want: %s", c.values, got, c.want)
+		}
+	}
+}
+
+func makeTestHistory() []historyRecord {
+	t0 := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []historyRecord{
+		{Time: t0, Commit: "0123456789abcdef",
+			Total: makeJSONCoverage(10, 5),
+			Packages: map[string]jsonCoverage{
+				"a": makeJSONCoverage(6, 3),
+				"b": makeJSONCoverage(4, 2),
+			}},
+		{Time: t0.Add(time.Hour), Commit: "fedcba9876543210",
+			Total: makeJSONCoverage(12, 9),
+			Packages: map[string]jsonCoverage{
+				"a": makeJSONCoverage(6, 6),
+				"b": makeJSONCoverage(4, 1),
+				"c": makeJSONCoverage(2, 2),
+			}},
+	}
+}
+
+func TestPackageMoves(t *testing.T) {
+	records := makeTestHistory()
+	moves := packageMoves(records[0], records[1])
+	wantPkgs := []string{"a", "b", "c"}
+	if len(moves) != len(wantPkgs) {
+		t.Fatalf("packageMoves got: %v", moves)
+	}
+	sum := 0.0
+	for i, m := range moves {
+		if m.pkg != wantPkgs[i] {
+			t.Errorf("packageMoves got: %v, want order: %v", moves, wantPkgs)
+		}
+		sum += m.delta
+	}
+	want := records[1].Total.Percent - records[0].Total.Percent
+	if math.Abs(sum-want) > 1e-9 {
+		t.Errorf("packageMoves sum: %f, want: %f", sum, want)
+	}
+}
+
+func TestPackageMoves_newUncovered(t *testing.T) {
+	t0 := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	prev := historyRecord{Time: t0,
+		Total: makeJSONCoverage(10, 5),
+		Packages: map[string]jsonCoverage{
+			"a": makeJSONCoverage(10, 5),
+		}}
+	last := historyRecord{Time: t0.Add(time.Hour),
+		Total: makeJSONCoverage(20, 6),
+		Packages: map[string]jsonCoverage{
+			"a": makeJSONCoverage(10, 6),
+			"z": makeJSONCoverage(10, 0),
+		}}
+	got := packageMoves(prev, last)
+	want := []packageMove{{pkg: "z", delta: -25}, {pkg: "a", delta: 5}}
+	if len(got) != len(want) {
+		t.Fatalf("packageMoves got: %v, want: %v", got, want)
+	}
+	for i, m := range got {
+		if m.pkg != want[i].pkg || math.Abs(m.delta-want[i].delta) > 1e-9 {
+			t.Errorf("packageMoves got: %v, want: %v", got, want)
+		}
+	}
+}
+
+func TestWriteHistoryReport(t *testing.T) {
+	var got bytes.Buffer
+	if err := writeHistoryReport(&got, makeTestHistory()); err != nil {
+		t.Fatalf("writeHistoryReport err: %s", err)
+	}
+	want := `Coverage history (2 runs):
+  2016-05-01 12:00  0123456  50.0%
+  2016-05-01 13:00  fedcba9  75.0%  +25.0%
+
+Total:  ▁█  50.0%  75.0%  +25.0%
+
+Packages:
+  a  ▁█  50.0%  100.0%  +50.0%
+  b  █▁  50.0%  25.0%   -25.0%
+  c   ▅  -      100.0%  new
+
+Biggest movers of the total in the last run:
+  a  +25.0%
+  b  -8.3%
+  c  +8.3%
+`
+	if got.String() != want {
+		t.Errorf("writeHistoryReport got:\n%s\nwant:\n%s", got.String(), want)
+	}
+}
+
+func TestRun_history(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	filename := filepath.Join(tmpDir, "history.jsonl")
+	htmlFilename := filepath.Join(tmpDir, "history.html")
+
+	prof := &profile{mode: "set", blocks: []profileBlock{
+		{file: "a/x.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 2, count: 1},
+		{file: "b/y.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 2, count: 0},
+	}}
+	now := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := historyReporter{filename: filename, now: func() time.Time { return now }}
+	for i := 0; i < 3; i++ {
+		if err := r.Report(prof, &runInfo{}); err != nil {
+			t.Fatalf("Report err: %s", err)
+		}
+	}
+
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{
+		os.Args[0], "history", "-n", "2", "-html", htmlFilename, filename,
+	}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+	if !strings.HasPrefix(gotOut.String(), "Coverage history (2 runs):\n") {
+		t.Errorf("Run: gotOut: %s", gotOut.String())
+	}
+	b, err := ioutil.ReadFile(htmlFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `<polyline fill="none" stroke="#000"`) {
+		t.Errorf("Run: html: %s", b)
+	}
+}
+
+func TestRun_historyErrors(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	filename := filepath.Join(tmpDir, "history.jsonl")
+	if err := ioutil.WriteFile(filename, []byte("{}\nbob\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	initProgram([]string{os.Args[0], "history", filename},
+		&gotOut, &gotErr, os.Getenv("GOPATH"))
+	if exitCode := program.Run(); exitCode != 1 {
+		t.Errorf("Run: incorrect exit code, got: %d, want: 1", exitCode)
+	}
+	want := "error reading: " + filename + ", line 2: "
+	if !strings.HasPrefix(gotErr.String(), want) {
+		t.Errorf("Run: gotErr: %s, want prefix: %s", gotErr.String(), want)
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// htmlTreeNode is a directory in the package tree of an HTML report
+type htmlTreeNode struct {
+	name     string
+	pkg      *packageCoverage
+	numStmt  int
+	covered  int
+	children []*htmlTreeNode
+}
+
+// htmlRow is a row in a table of an HTML report
+type htmlRow struct {
+	Name    string
+	Link    string
+	Depth   int
+	NumStmt int
+	Covered int
+	Percent float64
+}
+
+// htmlLine is a line of source in an HTML report
+type htmlLine struct {
+	Num   int
+	Class string
+	Hits  string
+	Text  string
+}
+
+// htmlPage is the data passed to the templates of an HTML report
+type htmlPage struct {
+	Title    string
+	Parent   htmlRow
+	Total    htmlRow
+	Rows     []htmlRow
+	Lines    []htmlLine
+	ShowHits bool
+	Err      string
+}
+
+// htmlReport writes a static HTML report to a directory
+type htmlReport struct {
+	dir      string
+	mode     string
+	resolver *pathResolver
+	pages    map[string]string
+	used     map[string]bool
+}
+
+// writeHTMLReport writes a static HTML report of prof to dir.  It consists
+// of an index with the package tree, a page for each package and a page for
+// each source file.
+func writeHTMLReport(dir string, prof *profile, resolver *pathResolver) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error writing to: %s, %s", dir, err)
+	}
+	r := &htmlReport{
+		dir:      dir,
+		mode:     prof.mode,
+		resolver: resolver,
+		pages:    map[string]string{},
+		used:     map[string]bool{"index.html": true},
+	}
+	summary := summarize(prof)
+	total := htmlRow{
+		Name:    "Total",
+		Link:    "index.html",
+		NumStmt: summary.numStmt,
+		Covered: summary.covered,
+		Percent: summary.percent(),
+	}
+	index := htmlPage{
+		Title: "Coverage",
+		Total: total,
+		Rows:  r.treeRows(packageTree(summary.packages), 0, nil),
+	}
+	if err := r.writePage("index.html", "index", index); err != nil {
+		return err
+	}
+	for _, pc := range summary.packages {
+		if err := r.writePackagePage(total, pc); err != nil {
+			return err
+		}
+		for _, f := range pc.files {
+			if err := r.writeFilePage(pc, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// packageTree returns the root of a tree of the packages, in which
+// directories with a single child and no package are joined to that child
+func packageTree(packages []*packageCoverage) *htmlTreeNode {
+	root := &htmlTreeNode{}
+	for _, pc := range packages {
+		n := root
+		n.numStmt += pc.numStmt
+		n.covered += pc.covered
+		for _, name := range strings.Split(pc.pkg, "/") {
+			n = n.child(name)
+			n.numStmt += pc.numStmt
+			n.covered += pc.covered
+		}
+		n.pkg = pc
+	}
+	root.compact()
+	return root
+}
+
+func (n *htmlTreeNode) child(name string) *htmlTreeNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &htmlTreeNode{name: name}
+	n.children = append(n.children, c)
+	return c
+}
+
+func (n *htmlTreeNode) compact() {
+	for _, c := range n.children {
+		for c.pkg == nil && len(c.children) == 1 {
+			gc := c.children[0]
+			c.name = c.name + "/" + gc.name
+			c.pkg = gc.pkg
+			c.children = gc.children
+		}
+		c.compact()
+	}
+	sort.Slice(n.children, func(i, j int) bool {
+		return n.children[i].name < n.children[j].name
+	})
+}
+
+// treeRows returns the rows of the index for the children of n
+func (r *htmlReport) treeRows(
+	n *htmlTreeNode,
+	depth int,
+	rows []htmlRow,
+) []htmlRow {
+	for _, c := range n.children {
+		row := htmlRow{
+			Name:    c.name,
+			Depth:   depth,
+			NumStmt: c.numStmt,
+			Covered: c.covered,
+			Percent: percent(c.covered, c.numStmt),
+		}
+		if c.pkg != nil {
+			row.Link = r.pageName("pkg", c.pkg.pkg)
+		}
+		rows = append(rows, row)
+		rows = r.treeRows(c, depth+1, rows)
+	}
+	return rows
+}
+
+func (r *htmlReport) writePackagePage(total htmlRow, pc *packageCoverage) error {
+	page := htmlPage{
+		Title:  pc.pkg,
+		Parent: total,
+		Total: htmlRow{
+			Name:    pc.pkg,
+			NumStmt: pc.numStmt,
+			Covered: pc.covered,
+			Percent: pc.percent(),
+		},
+	}
+	for _, f := range pc.files {
+		page.Rows = append(page.Rows, htmlRow{
+			Name:    strings.TrimPrefix(f.file, pc.pkg+"/"),
+			Link:    r.pageName("file", f.file),
+			NumStmt: f.numStmt,
+			Covered: f.covered,
+			Percent: f.percent(),
+		})
+	}
+	return r.writePage(r.pageName("pkg", pc.pkg), "package", page)
+}
+
+func (r *htmlReport) writeFilePage(
+	pc *packageCoverage,
+	f *fileCoverage,
+) error {
+	page := htmlPage{
+		Title: f.file,
+		Parent: htmlRow{
+			Name: pc.pkg,
+			Link: r.pageName("pkg", pc.pkg),
+		},
+		Total: htmlRow{
+			Name:    f.file,
+			NumStmt: f.numStmt,
+			Covered: f.covered,
+			Percent: f.percent(),
+		},
+		ShowHits: r.mode != "set",
+	}
+	src, err := readSourceLines(r.resolver, f.file)
+	if err != nil {
+		page.Err = fmt.Sprintf("source not available: %s", err)
+	}
+	lines := lineCoverage(f.blocks)
+	for i, text := range src {
+		line := htmlLine{Num: i + 1, Text: text}
+		if lh, ok := lines[i+1]; ok {
+			switch {
+			case lh.covered == 0:
+				line.Class = "uncov"
+			case lh.covered < lh.blocks:
+				line.Class = "partial"
+			default:
+				line.Class = "cov"
+			}
+			line.Hits = fmt.Sprintf("%d", lh.count)
+		}
+		page.Lines = append(page.Lines, line)
+	}
+	return r.writePage(r.pageName("file", f.file), "file", page)
+}
+
+// pageName returns the filename of the page for the package or file
+// called name, making sure that different names get different pages
+func (r *htmlReport) pageName(kind string, name string) string {
+	key := kind + ":" + name
+	if page, ok := r.pages[key]; ok {
+		return page
+	}
+	base := kind + "-" + unsafeFilenameRegexp.ReplaceAllString(name, "_")
+	page := base + ".html"
+	for i := 2; r.used[page]; i++ {
+		page = fmt.Sprintf("%s-%d.html", base, i)
+	}
+	r.used[page] = true
+	r.pages[key] = page
+	return page
+}
+
+func (r *htmlReport) writePage(name string, tmpl string, page htmlPage) error {
+	filename := filepath.Join(r.dir, name)
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	if err := htmlTemplates.ExecuteTemplate(f, tmpl, page); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	return f.Close()
+}
+
+// coverageClass returns the CSS class used to colour a percentage
+func coverageClass(percent float64) string {
+	switch {
+	case percent >= 80:
+		return "high"
+	case percent >= 50:
+		return "medium"
+	}
+	return "low"
+}
+
+var htmlTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"class":  coverageClass,
+	"indent": func(depth int) string { return fmt.Sprintf("%.1fem", 0.5+1.5*float64(depth)) },
+}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+a { color: #0645ad; text-decoration: none; }
+a:hover { text-decoration: underline; }
+table { border-collapse: collapse; }
+th, td { padding: 0.2em 0.5em; text-align: left; }
+td.num { text-align: right; }
+tr.row:hover { background: #f4f4f4; }
+.bar { display: inline-block; width: 8em; height: 0.8em; background: #e05d44; }
+.bar span { display: block; height: 100%; background: #4c1; }
+.high { color: #2a7a00; }
+.medium { color: #b08000; }
+.low { color: #c00; }
+.source { font-family: monospace; white-space: pre; }
+.source td { padding: 0 0.5em; }
+.source .ln, .source .hits { color: #999; text-align: right; }
+.cov { background: #dfd; }
+.uncov { background: #fdd; }
+.partial { background: #ffd; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "summary"}}<p>{{.Total.Covered}}/{{.Total.NumStmt}} statements covered,
+<span class="{{class .Total.Percent}}">{{printf "%.1f%%" .Total.Percent}}</span></p>
+{{end}}
+
+{{define "rows"}}<table>
+<tr><th>Name</th><th>Coverage</th><th></th><th>Statements</th></tr>
+{{range .Rows}}<tr class="row">
+<td style="padding-left: {{indent .Depth}}">{{if .Link}}<a href="{{.Link}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td>
+<td class="num {{class .Percent}}">{{printf "%.1f%%" .Percent}}</td>
+<td><span class="bar"><span style="width: {{printf "%.1f" .Percent}}%"></span></span></td>
+<td class="num">{{.Covered}}/{{.NumStmt}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+
+{{define "index"}}{{template "head" .}}<h1>Coverage</h1>
+{{template "summary" .}}{{template "rows" .}}</body>
+</html>
+{{end}}
+
+{{define "package"}}{{template "head" .}}<p><a href="{{.Parent.Link}}">{{.Parent.Name}}</a></p>
+<h1>{{.Title}}</h1>
+{{template "summary" .}}{{template "rows" .}}</body>
+</html>
+{{end}}
+
+{{define "file"}}{{template "head" .}}<p><a href="index.html">Total</a> / <a href="{{.Parent.Link}}">{{.Parent.Name}}</a></p>
+<h1>{{.Title}}</h1>
+{{template "summary" .}}{{if .Err}}<p class="low">{{.Err}}</p>
+{{end}}<table class="source">
+{{range .Lines}}<tr id="L{{.Num}}" class="{{.Class}}"><td class="ln"><a href="#L{{.Num}}">{{.Num}}</a></td>{{if $.ShowHits}}<td class="hits">{{.Hits}}</td>{{end}}<td>{{.Text}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+{{end}}
+`))
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackageTree(t *testing.T) {
+	packages := []*packageCoverage{
+		{pkg: "github.com/a/b", numStmt: 4, covered: 2},
+		{pkg: "github.com/a/b/c", numStmt: 4, covered: 4},
+		{pkg: "github.com/a/b/d/e", numStmt: 2, covered: 0},
+	}
+	r := &htmlReport{pages: map[string]string{}, used: map[string]bool{}}
+	got := r.treeRows(packageTree(packages), 0, nil)
+	want := []htmlRow{
+		{Name: "github.com/a/b", Link: "pkg-github.com_a_b.html",
+			Depth: 0, NumStmt: 10, Covered: 6, Percent: 60},
+		{Name: "c", Link: "pkg-github.com_a_b_c.html",
+			Depth: 1, NumStmt: 4, Covered: 4, Percent: 100},
+		{Name: "d/e", Link: "pkg-github.com_a_b_d_e.html",
+			Depth: 1, NumStmt: 2, Covered: 0, Percent: 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("treeRows got: %v, want: %v", got, want)
+	}
+	for i, row := range got {
+		if row != want[i] {
+			t.Errorf("treeRows got row: %v, want: %v", row, want[i])
+		}
+	}
+}
+
+func TestPageName(t *testing.T) {
+	r := &htmlReport{pages: map[string]string{}, used: map[string]bool{}}
+	names := []struct {
+		kind string
+		name string
+		want string
+	}{
+		{kind: "file", name: "a/b_c.go", want: "file-a_b_c.go.html"},
+		{kind: "file", name: "a_b/c.go", want: "file-a_b_c.go-2.html"},
+		{kind: "file", name: "a/b_c.go", want: "file-a_b_c.go.html"},
+		{kind: "pkg", name: "a", want: "pkg-a.html"},
+	}
+	for _, n := range names {
+		got := r.pageName(n.kind, n.name)
+		if got != n.want {
+			t.Errorf("pageName(%s, %s) got: %s, want: %s", n.kind, n.name, got, n.want)
+		}
+	}
+}
+
+func TestRun_html(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{os.Args[0], "-html", tmpDir}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir(filepath.Join("fixtures", "good")); err != nil {
+		t.Fatalf("ChDir err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+
+	const pkg = "github.com/lawrencewoodman/roveralls/fixtures/good"
+	pkgPage := "pkg-" + strings.Replace(pkg, "/", "_", -1) + ".html"
+	filePage := "file-" + strings.Replace(pkg, "/", "_", -1) + "_good.go.html"
+	cases := []struct {
+		page string
+		want []string
+	}{
+		{page: "index.html",
+			want: []string{"href=\"" + pkgPage + "\"", "100.0%"}},
+		{page: pkgPage,
+			want: []string{"href=\"" + filePage + "\">good.go</a>"}},
+		{page: filePage,
+			want: []string{
+				"<tr id=\"L5\" class=\"cov\">",
+				"<td class=\"hits\">1</td><td>\treturn true</td>",
+				"<tr id=\"L3\" class=\"\">",
+			}},
+	}
+	for _, c := range cases {
+		b, err := ioutil.ReadFile(filepath.Join(tmpDir, c.page))
+		if err != nil {
+			t.Errorf("ReadFile(%s) err: %s", c.page, err)
+			continue
+		}
+		for _, w := range c.want {
+			if !strings.Contains(string(b), w) {
+				t.Errorf("%s doesn't contain: %s", c.page, w)
+			}
+		}
+	}
+}
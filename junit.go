@@ -0,0 +1,186 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// packageTestName is the name given to the synthetic test case used to
+// report a package that failed without any of its tests failing, such as
+// when it fails to build
+const packageTestName = "[package]"
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// makeJUnit converts go test -json events into a JUnit report with one
+// test suite per package, or per package and -matrix entry if the events
+// were run under several
+func makeJUnit(events []testEvent) junitTestSuites {
+	var r junitTestSuites
+	var elapsed float64
+	suites := map[string]*junitTestSuite{}
+	suiteOrder := []string{}
+	cases := map[string]map[string]*junitTestCase{}
+	caseOrder := map[string][]string{}
+	pkgFailed := map[string]bool{}
+	pkgOutput := map[string]*strings.Builder{}
+
+	getCase := func(pkg, test string) *junitTestCase {
+		c, ok := cases[pkg][test]
+		if !ok {
+			c = &junitTestCase{Name: test, Classname: pkg, Time: formatSeconds(0)}
+			cases[pkg][test] = c
+			caseOrder[pkg] = append(caseOrder[pkg], test)
+		}
+		return c
+	}
+
+	for _, e := range events {
+		if e.Package == "" {
+			continue
+		}
+		pkg := junitSuiteName(e)
+		if _, ok := suites[pkg]; !ok {
+			suites[pkg] = &junitTestSuite{Name: pkg, Time: formatSeconds(0)}
+			suiteOrder = append(suiteOrder, pkg)
+			cases[pkg] = map[string]*junitTestCase{}
+			pkgOutput[pkg] = &strings.Builder{}
+		}
+		suite := suites[pkg]
+		if e.Test == "" {
+			switch e.Action {
+			case "output", "build-output":
+				pkgOutput[pkg].WriteString(e.Output)
+			case "pass", "fail", "skip":
+				suite.Time = formatSeconds(e.Elapsed)
+				elapsed += e.Elapsed
+				pkgFailed[pkg] = e.Action == "fail"
+			case "build-fail":
+				pkgFailed[pkg] = true
+			}
+			continue
+		}
+		c := getCase(pkg, e.Test)
+		switch e.Action {
+		case "output":
+			c.SystemOut += e.Output
+		case "pass":
+			c.Time = formatSeconds(e.Elapsed)
+		case "fail":
+			c.Time = formatSeconds(e.Elapsed)
+			c.Failure = &junitMessage{Message: "Failed", Body: c.SystemOut}
+		case "skip":
+			c.Time = formatSeconds(e.Elapsed)
+			c.Skipped = &junitMessage{Message: "Skipped", Body: c.SystemOut}
+		}
+	}
+
+	for _, pkg := range suiteOrder {
+		suite := suites[pkg]
+		for _, test := range caseOrder[pkg] {
+			c := cases[pkg][test]
+			suite.Tests++
+			if c.Failure != nil {
+				suite.Failures++
+			}
+			if c.Skipped != nil {
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, *c)
+		}
+		if pkgFailed[pkg] && suite.Failures == 0 {
+			output := pkgOutput[pkg].String()
+			suite.Tests++
+			suite.Failures++
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      packageTestName,
+				Classname: pkg,
+				Time:      suite.Time,
+				Failure:   &junitMessage{Message: "Package failed", Body: output},
+				SystemOut: output,
+			})
+		}
+		r.Tests += suite.Tests
+		r.Failures += suite.Failures
+		r.Skipped += suite.Skipped
+		r.Suites = append(r.Suites, *suite)
+	}
+	r.Time = formatSeconds(elapsed)
+	return r
+}
+
+// junitSuiteName returns the name of the test suite for the package of e,
+// followed by its -matrix entry if it has one, such as:
+// pkg [tags=integration]
+func junitSuiteName(e testEvent) string {
+	if e.Matrix == "" {
+		return e.Package
+	}
+	return fmt.Sprintf("%s [%s]", e.Package, e.Matrix)
+}
+
+func formatSeconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
+
+func writeJUnit(w io.Writer, events []testEvent) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(makeJUnit(events)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeJUnitFile writes a JUnit XML report of all the tests run to filename
+func (p *Program) writeJUnitFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	if err := writeJUnit(f, p.testEvents); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMakeJUnit(t *testing.T) {
+	events := []testEvent{
+		{Action: "start", Package: "pkg/a"},
+		{Action: "run", Package: "pkg/a", Test: "TestPass"},
+		{Action: "output", Package: "pkg/a", Test: "TestPass", Output: "=== RUN   TestPass\n"},
+		{Action: "pass", Package: "pkg/a", Test: "TestPass", Elapsed: 0.25},
+		{Action: "run", Package: "pkg/a", Test: "TestFail"},
+		{Action: "output", Package: "pkg/a", Test: "TestFail", Output: "    a_test.go:9: bad\n"},
+		{Action: "fail", Package: "pkg/a", Test: "TestFail", Elapsed: 0.5},
+		{Action: "run", Package: "pkg/a", Test: "TestSkip"},
+		{Action: "skip", Package: "pkg/a", Test: "TestSkip"},
+		{Action: "fail", Package: "pkg/a", Elapsed: 1},
+		{Action: "build-output", Package: "pkg/b", Output: "b.go:3: undefined: x\n"},
+		{Action: "build-fail", Package: "pkg/b"},
+		{Action: "fail", Package: "pkg/b"},
+	}
+	want := junitTestSuites{
+		Tests:    4,
+		Failures: 2,
+		Skipped:  1,
+		Time:     "1.000",
+		Suites: []junitTestSuite{
+			{Name: "pkg/a", Tests: 3, Failures: 1, Skipped: 1, Time: "1.000",
+				Cases: []junitTestCase{
+					{Name: "TestPass", Classname: "pkg/a", Time: "0.250",
+						SystemOut: "=== RUN   TestPass\n",
+					},
+					{Name: "TestFail", Classname: "pkg/a", Time: "0.500",
+						Failure:   &junitMessage{Message: "Failed", Body: "    a_test.go:9: bad\n"},
+						SystemOut: "    a_test.go:9: bad\n",
+					},
+					{Name: "TestSkip", Classname: "pkg/a", Time: "0.000",
+						Skipped: &junitMessage{Message: "Skipped"},
+					},
+				},
+			},
+			{Name: "pkg/b", Tests: 1, Failures: 1, Time: "0.000",
+				Cases: []junitTestCase{
+					{Name: packageTestName, Classname: "pkg/b", Time: "0.000",
+						Failure: &junitMessage{
+							Message: "Package failed",
+							Body:    "b.go:3: undefined: x\n",
+						},
+						SystemOut: "b.go:3: undefined: x\n",
+					},
+				},
+			},
+		},
+	}
+	got := makeJUnit(events)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("makeJUnit got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestMakeJUnit_matrix(t *testing.T) {
+	events := []testEvent{}
+	for _, matrix := range []string{"default", "tags=integration"} {
+		events = append(events,
+			testEvent{Action: "start", Package: "pkg/a", Matrix: matrix},
+			testEvent{Action: "run", Package: "pkg/a", Test: "TestA", Matrix: matrix},
+			testEvent{Action: "pass", Package: "pkg/a", Test: "TestA", Elapsed: 0.5, Matrix: matrix},
+			testEvent{Action: "pass", Package: "pkg/a", Elapsed: 1, Matrix: matrix},
+		)
+	}
+	want := junitTestSuites{
+		Tests: 2,
+		Time:  "2.000",
+		Suites: []junitTestSuite{
+			{Name: "pkg/a [default]", Tests: 1, Time: "1.000",
+				Cases: []junitTestCase{
+					{Name: "TestA", Classname: "pkg/a [default]", Time: "0.500"},
+				},
+			},
+			{Name: "pkg/a [tags=integration]", Tests: 1, Time: "1.000",
+				Cases: []junitTestCase{
+					{Name: "TestA", Classname: "pkg/a [tags=integration]", Time: "0.500"},
+				},
+			},
+		},
+	}
+	got := makeJUnit(events)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("makeJUnit got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestRun_junit(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	junitFilename := filepath.Join(tmpDir, "junit.xml")
+
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{os.Args[0], "-junit", junitFilename}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir("fixtures"); err != nil {
+		t.Fatalf("ChDir(fixtures) err: %s", err)
+	}
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+
+	b, err := ioutil.ReadFile(junitFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("xml.Unmarshal: %s", err)
+	}
+	if got.Failures != 0 {
+		t.Errorf("junit report got failures: %d, want: 0", got.Failures)
+	}
+	gotTests := map[string]bool{}
+	for _, s := range got.Suites {
+		for _, c := range s.Cases {
+			gotTests[c.Name] = c.Failure == nil
+		}
+	}
+	for _, test := range []string{"TestAmIGood", "TestAmIGood2", "TestAmIShort"} {
+		if passed, ok := gotTests[test]; !ok || !passed {
+			t.Errorf("junit report missing passing test: %s", test)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// markdownWorstFiles is the number of worst covered files listed in a
+// Markdown report
+const markdownWorstFiles = 10
+
+// markdownReporter writes a Markdown report comparing the coverage with an
+// optional baseline profile and listing the uncovered lines changed since
+// base, if set.  The report is also appended to $GITHUB_STEP_SUMMARY if
+// it is set.
+type markdownReporter struct {
+	filename    string
+	baseline    string
+	base        string
+	readProfile func(string) (*profile, error)
+	getenv      func(string) string
+}
+
+// writeMarkdown writes a Markdown report of prof.  If baseline isn't nil
+// the change in coverage from it is shown.  If changes isn't nil the
+// uncovered changed lines in it are listed.
+func writeMarkdown(
+	w io.Writer,
+	prof *profile,
+	baseline *profile,
+	changes []fileRanges,
+) error {
+	var b bytes.Buffer
+	summary := summarize(prof)
+	var baseSummary *coverageSummary
+	basePkgs := map[string]*packageCoverage{}
+	if baseline != nil {
+		baseSummary = summarize(baseline)
+		for _, pc := range baseSummary.packages {
+			basePkgs[pc.pkg] = pc
+		}
+	}
+
+	fmt.Fprintf(&b, "## Coverage\n\n")
+	fmt.Fprintf(&b, "**Total: %.1f%%** (%d/%d statements",
+		summary.percent(), summary.covered, summary.numStmt)
+	if baseSummary != nil {
+		fmt.Fprintf(&b, ", %s from baseline",
+			formatDelta(summary.percent()-baseSummary.percent()))
+	}
+	fmt.Fprintf(&b, ")\n\n")
+
+	if baseSummary != nil {
+		fmt.Fprintf(&b, "| Package | Coverage | Delta | Statements |\n")
+		fmt.Fprintf(&b, "|---|---:|---:|---:|\n")
+	} else {
+		fmt.Fprintf(&b, "| Package | Coverage | Statements |\n")
+		fmt.Fprintf(&b, "|---|---:|---:|\n")
+	}
+	for _, pc := range summary.packages {
+		fmt.Fprintf(&b, "| %s | %.1f%% |", escapeMarkdown(pc.pkg), pc.percent())
+		if baseSummary != nil {
+			if basePC, ok := basePkgs[pc.pkg]; ok {
+				fmt.Fprintf(&b, " %s |", formatDelta(pc.percent()-basePC.percent()))
+			} else {
+				fmt.Fprintf(&b, " new |")
+			}
+		}
+		fmt.Fprintf(&b, " %d/%d |\n", pc.covered, pc.numStmt)
+	}
+
+	worst := worstFiles(summary.files, markdownWorstFiles)
+	if len(worst) > 0 {
+		fmt.Fprintf(&b, "\n### Worst covered files\n\n")
+		fmt.Fprintf(&b, "| File | Coverage | Statements |\n")
+		fmt.Fprintf(&b, "|---|---:|---:|\n")
+		for _, f := range worst {
+			fmt.Fprintf(&b, "| %s | %.1f%% | %d/%d |\n",
+				escapeMarkdown(f.file), f.percent(), f.covered, f.numStmt)
+		}
+	}
+
+	if changes != nil {
+		numLines := 0
+		for _, f := range changes {
+			for _, lr := range f.ranges {
+				numLines += lr.end - lr.start + 1
+			}
+		}
+		fmt.Fprintf(&b, "\n<details>\n<summary>Uncovered changed lines (%d)</summary>\n\n",
+			numLines)
+		for _, f := range changes {
+			for _, lr := range f.ranges {
+				if lr.start == lr.end {
+					fmt.Fprintf(&b, "- `%s:%d`\n", f.path, lr.start)
+				} else {
+					fmt.Fprintf(&b, "- `%s:%d-%d`\n", f.path, lr.start, lr.end)
+				}
+			}
+		}
+		fmt.Fprintf(&b, "\n</details>\n")
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// worstFiles returns up to n of the files that aren't fully covered, with
+// the least covered first
+func worstFiles(files []*fileCoverage, n int) []*fileCoverage {
+	r := []*fileCoverage{}
+	for _, f := range files {
+		if f.covered < f.numStmt {
+			r = append(r, f)
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].percent() < r[j].percent()
+	})
+	if len(r) > n {
+		r = r[:n]
+	}
+	return r
+}
+
+// formatDelta returns a change in percentage with its sign
+func formatDelta(delta float64) string {
+	s := fmt.Sprintf("%+.1f%%", delta)
+	if s == "+0.0%" || s == "-0.0%" {
+		return "0.0%"
+	}
+	return s
+}
+
+// escapeMarkdown escapes the characters of s that would break a table
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "_", "\\_", "*", "\\*").Replace(s)
+}
+
+func (r markdownReporter) Report(prof *profile, run *runInfo) error {
+	var baseline *profile
+	if r.baseline != "" {
+		var err error
+		baseline, err = r.readProfile(r.baseline)
+		if err != nil {
+			return err
+		}
+	}
+	var changes []fileRanges
+	if r.base != "" {
+		var err error
+		changes, err = uncoveredChanges(prof, run, r.base)
+		if err != nil {
+			return err
+		}
+	}
+	var b bytes.Buffer
+	if err := writeMarkdown(&b, prof, baseline, changes); err != nil {
+		return err
+	}
+	err := writeReportFile(r.filename, run.out, func(w io.Writer) error {
+		_, err := w.Write(b.Bytes())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if stepSummary := r.getenv("GITHUB_STEP_SUMMARY"); stepSummary != "" {
+		f, err := os.OpenFile(stepSummary, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("error writing to: %s, %s", stepSummary, err)
+		}
+		if _, err := f.Write(b.Bytes()); err != nil {
+			f.Close()
+			return fmt.Errorf("error writing to: %s, %s", stepSummary, err)
+		}
+		return f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	prof := &profile{mode: "set", blocks: []profileBlock{
+		{file: "a/x.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 3, count: 1},
+		{file: "a/x.go", startLine: 3, startCol: 1, endLine: 4, endCol: 1, numStmt: 1, count: 0},
+		{file: "b/my_y.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 2, count: 0},
+		{file: "c/z.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 2, count: 1},
+	}}
+	baseline := &profile{mode: "set", blocks: []profileBlock{
+		{file: "a/x.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 4, count: 0},
+		{file: "c/z.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 2, count: 1},
+	}}
+	changes := []fileRanges{
+		{path: "a/x.go", ranges: []lineRange{{3, 3}}},
+		{path: "b/my_y.go", ranges: []lineRange{{1, 2}}},
+	}
+	cases := []struct {
+		baseline *profile
+		changes  []fileRanges
+		want     string
+	}{
+		{want: `## Coverage
+
+**Total: 62.5%** (5/8 statements)
+
+| Package | Coverage | Statements |
+|---|---:|---:|
+| a | 75.0% | 3/4 |
+| b | 0.0% | 0/2 |
+| c | 100.0% | 2/2 |
+
+### Worst covered files
+
+| File | Coverage | Statements |
+|---|---:|---:|
+| b/my\_y.go | 0.0% | 0/2 |
+| a/x.go | 75.0% | 3/4 |
+`},
+		{baseline: baseline,
+			changes: changes,
+			want: `## Coverage
+
+**Total: 62.5%** (5/8 statements, +29.2% from baseline)
+
+| Package | Coverage | Delta | Statements |
+|---|---:|---:|---:|
+| a | 75.0% | +75.0% | 3/4 |
+| b | 0.0% | new | 0/2 |
+| c | 100.0% | 0.0% | 2/2 |
+
+### Worst covered files
+
+| File | Coverage | Statements |
+|---|---:|---:|
+| b/my\_y.go | 0.0% | 0/2 |
+| a/x.go | 75.0% | 3/4 |
+
+<details>
+<summary>Uncovered changed lines (3)</summary>
+
+- ` + "`a/x.go:3`" + `
+- ` + "`b/my_y.go:1-2`" + `
+
+</details>
+`},
+	}
+	for _, c := range cases {
+		var got bytes.Buffer
+		if err := writeMarkdown(&got, prof, c.baseline, c.changes); err != nil {
+			t.Errorf("writeMarkdown err: %s", err)
+			continue
+		}
+		if got.String() != c.want {
+			t.Errorf("writeMarkdown got: %s, want: %s", got.String(), c.want)
+		}
+	}
+}
+
+func TestMarkdownReporter_stepSummary(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	stepSummary := filepath.Join(tmpDir, "step_summary.md")
+	if err := ioutil.WriteFile(stepSummary, []byte("before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(tmpDir, "coverage.md")
+	prof := &profile{mode: "set", blocks: []profileBlock{
+		{file: "a/x.go", startLine: 1, startCol: 1, endLine: 2, endCol: 1, numStmt: 1, count: 1},
+	}}
+	r := markdownReporter{
+		filename: filename,
+		getenv: makeGetenv(map[string]string{
+			"GITHUB_STEP_SUMMARY": stepSummary,
+		}),
+	}
+	if err := r.Report(prof, &runInfo{}); err != nil {
+		t.Fatalf("Report err: %s", err)
+	}
+	report, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(stepSummary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "before\n" + string(report)
+	if string(got) != want {
+		t.Errorf("Report got step summary: %s, want: %s", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// matrixEntry is a configuration to run the tests under
+type matrixEntry struct {
+	tags   string
+	goarch string
+	env    []string
+}
+
+// matrixFlag is a flag.Value that can be given multiple times to build up
+// the matrix of configurations to run the tests under
+type matrixFlag []matrixEntry
+
+// parseMatrixEntry parses a space separated list of settings of the form:
+// tags=tag1,tag2 goarch=arch env=NAME=VALUE.  env may be given more than
+// once and 'default' is an entry without any settings.
+func parseMatrixEntry(s string) (matrixEntry, error) {
+	e := matrixEntry{}
+	for _, field := range strings.Fields(s) {
+		if field == "default" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return e, fmt.Errorf("invalid matrix setting: %s", field)
+		}
+		switch kv[0] {
+		case "tags":
+			e.tags = kv[1]
+		case "goarch":
+			e.goarch = kv[1]
+		case "env":
+			if !strings.Contains(kv[1], "=") {
+				return e, fmt.Errorf("invalid matrix env: %s", kv[1])
+			}
+			e.env = append(e.env, kv[1])
+		default:
+			return e, fmt.Errorf("unknown matrix setting: %s", kv[0])
+		}
+	}
+	return e, nil
+}
+
+// String returns the settings of the entry in the form that it is given
+// on the command line
+func (e matrixEntry) String() string {
+	fields := []string{}
+	if e.tags != "" {
+		fields = append(fields, "tags="+e.tags)
+	}
+	if e.goarch != "" {
+		fields = append(fields, "goarch="+e.goarch)
+	}
+	for _, v := range e.env {
+		fields = append(fields, "env="+v)
+	}
+	if len(fields) == 0 {
+		return "default"
+	}
+	return strings.Join(fields, " ")
+}
+
+// environ returns the environment variables to add when running go test
+func (e matrixEntry) environ() []string {
+	env := []string{}
+	if e.goarch != "" {
+		env = append(env, "GOARCH="+e.goarch)
+	}
+	return append(env, e.env...)
+}
+
+func (m *matrixFlag) String() string {
+	if m == nil {
+		return ""
+	}
+	entries := make([]string, len(*m))
+	for i, e := range *m {
+		entries[i] = e.String()
+	}
+	return strings.Join(entries, ", ")
+}
+
+func (m *matrixFlag) Set(s string) error {
+	e, err := parseMatrixEntry(s)
+	if err != nil {
+		return err
+	}
+	*m = append(*m, e)
+	return nil
+}
+
+// reportMatrix outputs the coverage of each matrix entry along with the
+// number of statements that were only covered by that entry
+func reportMatrix(
+	out io.Writer,
+	entries []matrixEntry,
+	profs []*profile,
+) {
+	coveredBy := map[blockKey]int{}
+	for _, prof := range profs {
+		for _, b := range prof.blocks {
+			if b.count > 0 {
+				coveredBy[b.key()]++
+			}
+		}
+	}
+	fmt.Fprintln(out, "Matrix coverage:")
+	for i, prof := range profs {
+		numStmt, covered := prof.coverage()
+		onlyCovered := 0
+		for _, b := range prof.blocks {
+			if b.count > 0 && coveredBy[b.key()] == 1 {
+				onlyCovered += b.numStmt
+			}
+		}
+		fmt.Fprintf(out,
+			"  %s: %.1f%% of statements, %d statements only covered by this entry\n",
+			entries[i], percent(covered, numStmt), onlyCovered)
+	}
+}
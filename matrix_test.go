@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseMatrixEntry(t *testing.T) {
+	cases := []struct {
+		in   string
+		want matrixEntry
+	}{
+		{in: "default", want: matrixEntry{}},
+		{in: "", want: matrixEntry{}},
+		{in: "tags=integration,purego",
+			want: matrixEntry{tags: "integration,purego"},
+		},
+		{in: "goarch=386 env=CGO_ENABLED=0 env=FOO=bar",
+			want: matrixEntry{
+				goarch: "386",
+				env:    []string{"CGO_ENABLED=0", "FOO=bar"},
+			},
+		},
+	}
+	for _, c := range cases {
+		got, err := parseMatrixEntry(c.in)
+		if err != nil {
+			t.Errorf("parseMatrixEntry(%s) err: %s", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseMatrixEntry(%s) got: %v, want: %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseMatrixEntry_errors(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantErr string
+	}{
+		{in: "tags", wantErr: "invalid matrix setting: tags"},
+		{in: "goos=linux", wantErr: "unknown matrix setting: goos"},
+		{in: "env=FOO", wantErr: "invalid matrix env: FOO"},
+	}
+	for _, c := range cases {
+		_, err := parseMatrixEntry(c.in)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("parseMatrixEntry(%s) got err: %v, want: %s",
+				c.in, err, c.wantErr)
+		}
+	}
+}
+
+func TestMatrixEntryString(t *testing.T) {
+	cases := []struct {
+		entry matrixEntry
+		want  string
+	}{
+		{entry: matrixEntry{}, want: "default"},
+		{entry: matrixEntry{tags: "a,b", goarch: "386", env: []string{"X=1"}},
+			want: "tags=a,b goarch=386 env=X=1",
+		},
+	}
+	for _, c := range cases {
+		if got := c.entry.String(); got != c.want {
+			t.Errorf("String() got: %s, want: %s", got, c.want)
+		}
+	}
+}
+
+func TestRun_matrix(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{
+		os.Args[0],
+		"-matrix", "default",
+		"-matrix", "tags=roverallsintegration",
+	}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir(filepath.Join("testdata", "matrix")); err != nil {
+		t.Fatalf("ChDir err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+	wantOutRegexps := []string{
+		"^Matrix coverage:$",
+		"^  default: 50.0% of statements, 0 statements only covered by this entry$",
+		"^  tags=roverallsintegration: 100.0% of statements, 1 statements only covered by this entry$",
+	}
+	if err := checkOutput(wantOutRegexps, gotOut.String()); err != nil {
+		t.Errorf("checkOutput: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(outFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof, err := parseProfile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prof.blocks) != 2 {
+		t.Fatalf("profile got blocks: %v, want 2 blocks", prof.blocks)
+	}
+	// The count for Plain is from both entries
+	wantCounts := []int{2, 1}
+	for i, b := range prof.blocks {
+		if b.count != wantCounts[i] {
+			t.Errorf("block: %s, got count: %d, want: %d", b, b.count, wantCounts[i])
+		}
+	}
+}
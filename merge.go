@@ -0,0 +1,136 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func (p *Program) mergeUsageMsg(fs *flag.FlagSet) string {
+	var b bytes.Buffer
+	const desc = `
+roveralls merge combines coverage profiles, such as those created by
+separate CI shards, into a single sorted profile.  If no profiles are
+given, or a profile is '-', it is read from stdin.
+`
+	fmt.Fprintf(&b, "%s\n", desc)
+	fmt.Fprintf(&b, "Usage: roveralls merge [-o filename] [profile ...]\n")
+	fs.SetOutput(&b)
+	fs.PrintDefaults()
+	fs.SetOutput(p.outErr)
+	return b.String()
+}
+
+// runMerge runs the merge subcommand
+func (p *Program) runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	fs.SetOutput(p.outErr)
+	fs.StringVar(
+		&p.mergeOutput,
+		"o",
+		"-",
+		"Write the merged profile to `filename`, '-' for stdout",
+	)
+	p.initPathFlags(fs)
+	fs.BoolVar(&p.help, "help", false, "Display this help")
+	fs.Usage = func() {
+		fmt.Fprint(p.outErr, p.mergeUsageMsg(fs))
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if p.help {
+		fmt.Fprint(p.out, p.mergeUsageMsg(fs))
+		return 0
+	}
+
+	filenames := fs.Args()
+	if len(filenames) == 0 {
+		filenames = []string{"-"}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(p.outErr, "%s\n", err)
+		return 1
+	}
+	rewriter, err := p.newPathRewriter(wd)
+	if err != nil {
+		fmt.Fprintf(p.outErr, "%s\n", err)
+		return 1
+	}
+	prof, err := p.mergeProfileFiles(filenames)
+	if err != nil {
+		fmt.Fprintf(p.outErr, "%s\n", err)
+		return 1
+	}
+	prof, err = rewriter.rewriteProfile(prof)
+	if err != nil {
+		fmt.Fprintf(p.outErr, "%s\n", err)
+		return 1
+	}
+	prof.sort()
+	if p.mergeOutput == "-" {
+		err = prof.write(p.out)
+	} else {
+		err = writeProfileFile(p.mergeOutput, prof)
+	}
+	if err != nil {
+		fmt.Fprintf(p.outErr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// mergeProfileFiles reads and merges the coverage profiles in filenames,
+// where a filename of '-' is read from p.in
+func (p *Program) mergeProfileFiles(filenames []string) (*profile, error) {
+	profs := make([]*profile, len(filenames))
+	mode := ""
+	modeFilename := ""
+	for i, filename := range filenames {
+		prof, err := p.readProfileFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if mode == "" {
+			mode = prof.mode
+			modeFilename = filename
+		} else if prof.mode != mode {
+			return nil, fmt.Errorf("mixed modes: %s has mode: %s, %s has mode: %s",
+				modeFilename, mode, filename, prof.mode)
+		}
+		profs[i] = prof
+	}
+	return mergeProfiles(mode, profs...)
+}
+
+func (p *Program) readProfileFile(filename string) (*profile, error) {
+	var r io.Reader
+	name := filename
+	if filename == "-" {
+		r = p.in
+		name = "stdin"
+	} else {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	prof, err := parseProfile(r)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing: %s, %s", name, err)
+	}
+	// An empty or truncated profile would otherwise add nothing without
+	// any sign that it is damaged
+	if prof.mode == "" {
+		return nil, fmt.Errorf("error parsing: %s, missing mode line", name)
+	}
+	return prof, nil
+}
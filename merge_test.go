@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_merge(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	files := map[string]string{
+		"a.out": "mode: count\n" +
+			"example.com/b/b.go:3.20,5.2 1 1\n" +
+			"example.com/a/a.go:7.2,8.3 2 0\n",
+		"b.out": "mode: count\n" +
+			"example.com/a/a.go:7.2,8.3 2 4\n" +
+			"example.com/a/a.go:3.20,5.2 1 0\n",
+		"set.out": "mode: set\n" +
+			"example.com/a/a.go:7.2,8.3 2 1\n",
+		"empty.out": "",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	outFile := filepath.Join(tmpDir, "merged.out")
+	wantMerged := "mode: count\n" +
+		"example.com/a/a.go:3.20,5.2 1 0\n" +
+		"example.com/a/a.go:7.2,8.3 2 4\n" +
+		"example.com/b/b.go:3.20,5.2 1 1\n"
+
+	cases := []struct {
+		cmdArgs      []string
+		stdin        string
+		wantExitCode int
+		wantOut      string
+		wantErr      string
+		wantFile     string
+	}{
+		{cmdArgs: []string{"merge",
+			filepath.Join(tmpDir, "a.out"),
+			filepath.Join(tmpDir, "b.out"),
+		},
+			wantOut: wantMerged,
+		},
+		{cmdArgs: []string{"merge", "-o", outFile,
+			filepath.Join(tmpDir, "a.out"),
+			"-",
+		},
+			stdin:    files["b.out"],
+			wantFile: wantMerged,
+		},
+		{cmdArgs: []string{"merge"},
+			stdin: files["b.out"],
+			wantOut: "mode: count\n" +
+				"example.com/a/a.go:3.20,5.2 1 0\n" +
+				"example.com/a/a.go:7.2,8.3 2 4\n",
+		},
+		{cmdArgs: []string{"merge",
+			filepath.Join(tmpDir, "a.out"),
+			filepath.Join(tmpDir, "set.out"),
+		},
+			wantExitCode: 1,
+			wantErr: "mixed modes: " + filepath.Join(tmpDir, "a.out") +
+				" has mode: count, " + filepath.Join(tmpDir, "set.out") +
+				" has mode: set\n",
+		},
+		{cmdArgs: []string{"merge"},
+			stdin:        "mode: set\nbad line\n",
+			wantExitCode: 1,
+			wantErr:      "error parsing: stdin, line 2: invalid block: bad line\n",
+		},
+		{cmdArgs: []string{"merge",
+			filepath.Join(tmpDir, "empty.out"),
+			filepath.Join(tmpDir, "a.out"),
+		},
+			wantExitCode: 1,
+			wantErr: "error parsing: " + filepath.Join(tmpDir, "empty.out") +
+				", missing mode line\n",
+		},
+		{cmdArgs: []string{"merge", filepath.Join(tmpDir, "a.out"), "-"},
+			stdin:        "\n",
+			wantExitCode: 1,
+			wantErr:      "error parsing: stdin, missing mode line\n",
+		},
+	}
+	for _, c := range cases {
+		var gotOut bytes.Buffer
+		var gotErr bytes.Buffer
+		os.Remove(outFile)
+		cmdArgs := append([]string{os.Args[0]}, c.cmdArgs...)
+		initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+		program.in = strings.NewReader(c.stdin)
+		exitCode := program.Run()
+		if exitCode != c.wantExitCode {
+			t.Errorf("Run(%s): incorrect exit code, got: %d, want: %d",
+				c.cmdArgs, exitCode, c.wantExitCode)
+		}
+		if gotErr.String() != c.wantErr {
+			t.Errorf("Run(%s): gotErr: %s, wantErr: %s",
+				c.cmdArgs, gotErr.String(), c.wantErr)
+		}
+		if gotOut.String() != c.wantOut {
+			t.Errorf("Run(%s): gotOut: %s, wantOut: %s",
+				c.cmdArgs, gotOut.String(), c.wantOut)
+		}
+		if c.wantFile != "" {
+			b, err := ioutil.ReadFile(outFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != c.wantFile {
+				t.Errorf("Run(%s): got file: %s, want: %s", c.cmdArgs, b, c.wantFile)
+			}
+		}
+	}
+}
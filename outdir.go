@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+const (
+	outDirIndexFilename  = "index.json"
+	outDirProfile        = "profile.coverprofile"
+	outDirStdout         = "stdout.jsonl"
+	outDirStderr         = "stderr.txt"
+	outDirResultFilename = "result.json"
+)
+
+// outDirResult is the result of running go test on a package that is to
+// be kept in the outdir
+type outDirResult struct {
+	pkg      string
+	rel      string
+	entry    matrixEntry
+	dir      string
+	stdout   []byte
+	stderr   []byte
+	runErr   error
+	outcome  goTestOutcome
+	duration time.Duration
+}
+
+// outDirIndexEntry ties a package to the files kept for it in the outdir.
+// The filenames are relative to the outdir.
+type outDirIndexEntry struct {
+	Package     string            `json:"package"`
+	Dir         string            `json:"dir"`
+	MatrixEntry string            `json:"matrixEntry"`
+	Files       map[string]string `json:"files"`
+	ExitStatus  int               `json:"exitStatus"`
+	Outcome     string            `json:"outcome"`
+	Seconds     float64           `json:"seconds"`
+}
+
+var unsafeFilenameRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// packageOutDir returns the directory in the outdir for the package in
+// dir rel, mirroring the package's path.  When more than one matrix entry
+// is used each entry gets its own sub-directory.
+func (p *Program) packageOutDir(rel string, entry matrixEntry) string {
+	dir := filepath.Join(p.outDir, rel)
+	if len(p.matrix) > 1 {
+		dir = filepath.Join(dir,
+			unsafeFilenameRegexp.ReplaceAllString(entry.String(), "_"))
+	}
+	return dir
+}
+
+// keepOutput writes the output from go test to the package's directory in
+// the outdir and adds it to the index
+func (p *Program) keepOutput(r outDirResult) error {
+	files := map[string]string{
+		"stdout": filepath.Join(r.dir, outDirStdout),
+		"stderr": filepath.Join(r.dir, outDirStderr),
+	}
+	if err := ioutil.WriteFile(files["stdout"], r.stdout, 0644); err != nil {
+		return fmt.Errorf("error writing to: %s, %s", files["stdout"], err)
+	}
+	if err := ioutil.WriteFile(files["stderr"], r.stderr, 0644); err != nil {
+		return fmt.Errorf("error writing to: %s, %s", files["stderr"], err)
+	}
+	profileFilename := filepath.Join(r.dir, outDirProfile)
+	if _, err := os.Stat(profileFilename); err == nil {
+		files["profile"] = profileFilename
+	}
+
+	entry := outDirIndexEntry{
+		Package:     r.pkg,
+		Dir:         filepath.ToSlash(r.rel),
+		MatrixEntry: r.entry.String(),
+		Files:       map[string]string{},
+		ExitStatus:  exitStatus(r.runErr),
+		Outcome:     r.outcome.String(),
+		Seconds:     r.duration.Seconds(),
+	}
+	resultFilename := filepath.Join(r.dir, outDirResultFilename)
+	files["result"] = resultFilename
+	for kind, filename := range files {
+		rel, err := filepath.Rel(p.outDir, filename)
+		if err != nil {
+			return fmt.Errorf("can't create relative path")
+		}
+		entry.Files[kind] = filepath.ToSlash(rel)
+	}
+	if err := writeJSONFile(resultFilename, entry); err != nil {
+		return err
+	}
+	p.outIndex = append(p.outIndex, entry)
+	return nil
+}
+
+// writeOutDirIndex writes the index of the packages to the outdir
+func (p *Program) writeOutDirIndex() error {
+	if err := os.MkdirAll(p.outDir, 0755); err != nil {
+		return err
+	}
+	index := p.outIndex
+	if index == nil {
+		index = []outDirIndexEntry{}
+	}
+	return writeJSONFile(filepath.Join(p.outDir, outDirIndexFilename), index)
+}
+
+// exitStatus returns the exit status of a command from the error it
+// returned when run
+func exitStatus(runErr error) int {
+	if runErr == nil {
+		return 0
+	}
+	if exitErr, ok := runErr.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func writeJSONFile(filename string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackageOutDir(t *testing.T) {
+	cases := []struct {
+		matrix matrixFlag
+		rel    string
+		entry  matrixEntry
+		want   string
+	}{
+		{rel: "a/b", want: filepath.Join("out", "a", "b")},
+		{matrix: matrixFlag{{}, {tags: "x,y"}},
+			rel:   "a/b",
+			entry: matrixEntry{tags: "x,y"},
+			want:  filepath.Join("out", "a", "b", "tags_x_y"),
+		},
+	}
+	for _, c := range cases {
+		p := &Program{outDir: "out", matrix: c.matrix}
+		got := p.packageOutDir(c.rel, c.entry)
+		if got != c.want {
+			t.Errorf("packageOutDir(%s, %s) got: %s, want: %s",
+				c.rel, c.entry, got, c.want)
+		}
+	}
+}
+
+func TestRun_outdir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{os.Args[0], "-outdir", tmpDir}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir("fixtures"); err != nil {
+		t.Fatalf("ChDir(fixtures) err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(tmpDir, outDirIndexFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := []outDirIndexEntry{}
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	gotEntries := map[string]outDirIndexEntry{}
+	for _, e := range index {
+		gotEntries[e.Dir] = e
+	}
+	cases := []struct {
+		dir         string
+		wantOutcome string
+		wantStatus  int
+		wantProfile bool
+	}{
+		{dir: "build-excluded",
+			wantOutcome: "build constraints exclude all Go files",
+			wantStatus:  1,
+		},
+		{dir: "good", wantOutcome: "tests passed", wantProfile: true},
+		{dir: "good2", wantOutcome: "tests passed", wantProfile: true},
+	}
+	for _, c := range cases {
+		e, ok := gotEntries[c.dir]
+		if !ok {
+			t.Errorf("index missing dir: %s", c.dir)
+			continue
+		}
+		if e.Outcome != c.wantOutcome || e.ExitStatus != c.wantStatus {
+			t.Errorf("index entry: %s, got outcome: %s, status: %d, want: %s, %d",
+				c.dir, e.Outcome, e.ExitStatus, c.wantOutcome, c.wantStatus)
+		}
+		if _, ok := e.Files["profile"]; c.wantProfile && !ok {
+			t.Errorf("index entry: %s, missing profile", c.dir)
+		}
+		for _, filename := range e.Files {
+			if _, err := os.Stat(filepath.Join(tmpDir, filename)); err != nil {
+				t.Errorf("index entry: %s, file: %s", c.dir, err)
+			}
+		}
+	}
+}
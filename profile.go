@@ -0,0 +1,254 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// profileBlock is a block of statements from a coverage profile
+type profileBlock struct {
+	file      string
+	startLine int
+	startCol  int
+	endLine   int
+	endCol    int
+	numStmt   int
+	count     int
+}
+
+// blockKey identifies a block by its position
+type blockKey struct {
+	file      string
+	startLine int
+	startCol  int
+	endLine   int
+	endCol    int
+}
+
+// profile is a parsed coverage profile
+type profile struct {
+	mode   string
+	blocks []profileBlock
+}
+
+type profileError struct {
+	line int
+	msg  string
+}
+
+func (e profileError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+var blockLineRegexp = regexp.MustCompile(
+	`^(.+):(\d+)\.(\d+),(\d+)\.(\d+) (\d+) (\d+)$`,
+)
+
+func (b profileBlock) key() blockKey {
+	return blockKey{
+		file:      b.file,
+		startLine: b.startLine,
+		startCol:  b.startCol,
+		endLine:   b.endLine,
+		endCol:    b.endCol,
+	}
+}
+
+func (b profileBlock) String() string {
+	return fmt.Sprintf("%s:%d.%d,%d.%d %d %d", b.file,
+		b.startLine, b.startCol, b.endLine, b.endCol, b.numStmt, b.count)
+}
+
+// parseBlockLine parses a line of a coverage profile describing a block
+func parseBlockLine(line string) (profileBlock, error) {
+	m := blockLineRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return profileBlock{}, fmt.Errorf("invalid block: %s", line)
+	}
+	nums := make([]int, 6)
+	for i := range nums {
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return profileBlock{}, fmt.Errorf("invalid number in block: %s", line)
+		}
+		nums[i] = n
+	}
+	return profileBlock{
+		file:      m[1],
+		startLine: nums[0],
+		startCol:  nums[1],
+		endLine:   nums[2],
+		endCol:    nums[3],
+		numStmt:   nums[4],
+		count:     nums[5],
+	}, nil
+}
+
+// parseMode parses a mode line of a coverage profile
+func parseMode(line string) (string, bool) {
+	if !strings.HasPrefix(line, "mode: ") {
+		return "", false
+	}
+	return strings.TrimPrefix(line, "mode: "), true
+}
+
+// parseProfile parses a coverage profile.  It accepts the concatenated
+// output of several go test runs, as long as they all use the same mode.
+func parseProfile(r io.Reader) (*profile, error) {
+	prof := &profile{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if mode, ok := parseMode(line); ok {
+			if prof.mode != "" && prof.mode != mode {
+				return nil, profileError{
+					line: lineNum,
+					msg:  fmt.Sprintf("mixed modes: %s and %s", prof.mode, mode),
+				}
+			}
+			prof.mode = mode
+			continue
+		}
+		if prof.mode == "" {
+			return nil, profileError{line: lineNum, msg: "missing mode line"}
+		}
+		b, err := parseBlockLine(line)
+		if err != nil {
+			return nil, profileError{line: lineNum, msg: err.Error()}
+		}
+		prof.blocks = append(prof.blocks, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return prof, nil
+}
+
+// mergeProfiles merges profiles that use mode into a single profile.
+// Identical blocks are combined: in set mode a block is covered if it is
+// covered in any profile, otherwise the counts are added together.  Blocks
+// are kept in the order that they were first seen.
+func mergeProfiles(mode string, profs ...*profile) (*profile, error) {
+	r := &profile{mode: mode}
+	index := map[blockKey]int{}
+	for _, prof := range profs {
+		if prof.mode != "" && prof.mode != mode {
+			return nil, fmt.Errorf("can't merge profile with mode: %s, into mode: %s",
+				prof.mode, mode)
+		}
+		for _, b := range prof.blocks {
+			i, ok := index[b.key()]
+			if !ok {
+				index[b.key()] = len(r.blocks)
+				r.blocks = append(r.blocks, b)
+				continue
+			}
+			mb := &r.blocks[i]
+			if mb.numStmt != b.numStmt {
+				return nil, fmt.Errorf("inconsistent number of statements for block: %s",
+					b)
+			}
+			mb.count = mergeCounts(mode, mb.count, b.count)
+		}
+	}
+	return r, nil
+}
+
+func mergeCounts(mode string, a, b int) int {
+	if mode == "set" {
+		if a > 0 || b > 0 {
+			return 1
+		}
+		return 0
+	}
+	return a + b
+}
+
+// dedupe removes blocks that are exact duplicates of an earlier block,
+// which happens when go test outputs the same line more than once
+func (prof *profile) dedupe() {
+	seen := make(map[profileBlock]bool, len(prof.blocks))
+	blocks := prof.blocks[:0]
+	for _, b := range prof.blocks {
+		if !seen[b] {
+			seen[b] = true
+			blocks = append(blocks, b)
+		}
+	}
+	prof.blocks = blocks
+}
+
+// dropEmpty removes blocks that don't contain any statements
+func (prof *profile) dropEmpty() {
+	blocks := prof.blocks[:0]
+	for _, b := range prof.blocks {
+		if b.numStmt > 0 {
+			blocks = append(blocks, b)
+		}
+	}
+	prof.blocks = blocks
+}
+
+// sort orders the blocks by file and then by position
+func (prof *profile) sort() {
+	sort.SliceStable(prof.blocks, func(i, j int) bool {
+		a, b := prof.blocks[i], prof.blocks[j]
+		if a.file != b.file {
+			return a.file < b.file
+		}
+		if a.startLine != b.startLine {
+			return a.startLine < b.startLine
+		}
+		if a.startCol != b.startCol {
+			return a.startCol < b.startCol
+		}
+		if a.endLine != b.endLine {
+			return a.endLine < b.endLine
+		}
+		return a.endCol < b.endCol
+	})
+}
+
+// coverage returns the number of statements and the number of those
+// statements that were covered
+func (prof *profile) coverage() (numStmt int, covered int) {
+	for _, b := range prof.blocks {
+		numStmt += b.numStmt
+		if b.count > 0 {
+			covered += b.numStmt
+		}
+	}
+	return numStmt, covered
+}
+
+// write outputs the profile in the format used by go test -coverprofile
+func (prof *profile) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", prof.mode)
+	for _, b := range prof.blocks {
+		fmt.Fprintln(bw, b)
+	}
+	return bw.Flush()
+}
+
+// percent returns n as a percentage of total
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
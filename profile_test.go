@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProfile(t *testing.T) {
+	in := "mode: count\n" +
+		"example.com/a/a.go:3.20,5.2 1 2\n" +
+		"mode: count\n" +
+		"example.com/b/b.go:7.14,9.3 2 0\n"
+	want := &profile{
+		mode: "count",
+		blocks: []profileBlock{
+			{file: "example.com/a/a.go", startLine: 3, startCol: 20,
+				endLine: 5, endCol: 2, numStmt: 1, count: 2},
+			{file: "example.com/b/b.go", startLine: 7, startCol: 14,
+				endLine: 9, endCol: 3, numStmt: 2, count: 0},
+		},
+	}
+	got, err := parseProfile(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parseProfile: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProfile got: %v, want: %v", got, want)
+	}
+}
+
+func TestParseProfile_errors(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantErr string
+	}{
+		{in: "example.com/a/a.go:3.20,5.2 1 2\n",
+			wantErr: "line 1: missing mode line",
+		},
+		{in: "mode: count\nmode: set\n",
+			wantErr: "line 2: mixed modes: count and set",
+		},
+		{in: "mode: count\nexample.com/a/a.go:3.20,5.2 1\n",
+			wantErr: "line 2: invalid block: example.com/a/a.go:3.20,5.2 1",
+		},
+	}
+	for _, c := range cases {
+		_, err := parseProfile(strings.NewReader(c.in))
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("parseProfile(%q) got err: %v, want: %s", c.in, err, c.wantErr)
+		}
+	}
+}
+
+func TestMergeProfiles(t *testing.T) {
+	a := profileBlock{file: "a.go", startLine: 1, startCol: 1,
+		endLine: 2, endCol: 2, numStmt: 1}
+	b := profileBlock{file: "b.go", startLine: 1, startCol: 1,
+		endLine: 2, endCol: 2, numStmt: 3}
+	withCount := func(pb profileBlock, count int) profileBlock {
+		pb.count = count
+		return pb
+	}
+	cases := []struct {
+		mode  string
+		profs []*profile
+		want  []profileBlock
+	}{
+		{mode: "count",
+			profs: []*profile{
+				{mode: "count", blocks: []profileBlock{withCount(a, 2)}},
+				{mode: "count", blocks: []profileBlock{withCount(b, 0), withCount(a, 3)}},
+			},
+			want: []profileBlock{withCount(a, 5), withCount(b, 0)},
+		},
+		{mode: "set",
+			profs: []*profile{
+				{mode: "set", blocks: []profileBlock{withCount(a, 1), withCount(b, 0)}},
+				{mode: "set", blocks: []profileBlock{withCount(a, 1), withCount(b, 1)}},
+			},
+			want: []profileBlock{withCount(a, 1), withCount(b, 1)},
+		},
+	}
+	for _, c := range cases {
+		got, err := mergeProfiles(c.mode, c.profs...)
+		if err != nil {
+			t.Fatalf("mergeProfiles: %s", err)
+		}
+		if got.mode != c.mode || !reflect.DeepEqual(got.blocks, c.want) {
+			t.Errorf("mergeProfiles got: %v, want: %v", got.blocks, c.want)
+		}
+	}
+}
+
+func TestMergeProfiles_errors(t *testing.T) {
+	a := profileBlock{file: "a.go", startLine: 1, startCol: 1,
+		endLine: 2, endCol: 2, numStmt: 1}
+	a2 := a
+	a2.numStmt = 2
+	cases := []struct {
+		profs   []*profile
+		wantErr string
+	}{
+		{profs: []*profile{{mode: "set"}},
+			wantErr: "can't merge profile with mode: set, into mode: count",
+		},
+		{profs: []*profile{
+			{mode: "count", blocks: []profileBlock{a}},
+			{mode: "count", blocks: []profileBlock{a2}},
+		},
+			wantErr: "inconsistent number of statements for block: a.go:1.1,2.2 2 0",
+		},
+	}
+	for _, c := range cases {
+		_, err := mergeProfiles("count", c.profs...)
+		if err == nil || err.Error() != c.wantErr {
+			t.Errorf("mergeProfiles got err: %v, want: %s", err, c.wantErr)
+		}
+	}
+}
+
+func TestProfileWrite(t *testing.T) {
+	prof := &profile{
+		mode: "set",
+		blocks: []profileBlock{
+			{file: "example.com/a/a.go", startLine: 3, startCol: 20,
+				endLine: 5, endCol: 2, numStmt: 1, count: 1},
+		},
+	}
+	want := "mode: set\nexample.com/a/a.go:3.20,5.2 1 1\n"
+	var got bytes.Buffer
+	if err := prof.write(&got); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if got.String() != want {
+		t.Errorf("write got: %s, want: %s", got.String(), want)
+	}
+}
+
+func TestProfileDedupe(t *testing.T) {
+	a := profileBlock{file: "a.go", startLine: 1, startCol: 1,
+		endLine: 2, endCol: 2, numStmt: 1, count: 1}
+	a2 := a
+	a2.count = 2
+	prof := &profile{mode: "count", blocks: []profileBlock{a, a2, a, a2}}
+	prof.dedupe()
+	want := []profileBlock{a, a2}
+	if !reflect.DeepEqual(prof.blocks, want) {
+		t.Errorf("dedupe got: %v, want: %v", prof.blocks, want)
+	}
+}
+
+func TestProfileDropEmpty(t *testing.T) {
+	a := profileBlock{file: "a.go", startLine: 1, startCol: 1,
+		endLine: 2, endCol: 2, numStmt: 1, count: 1}
+	empty := profileBlock{file: "a.go", startLine: 3, startCol: 1,
+		endLine: 3, endCol: 2, numStmt: 0, count: 1}
+	prof := &profile{mode: "count", blocks: []profileBlock{empty, a, empty}}
+	prof.dropEmpty()
+	want := []profileBlock{a}
+	if !reflect.DeepEqual(prof.blocks, want) {
+		t.Errorf("dropEmpty got: %v, want: %v", prof.blocks, want)
+	}
+}
+
+func TestProfileSort(t *testing.T) {
+	block := func(file string, sl, sc, el, ec int) profileBlock {
+		return profileBlock{file: file, startLine: sl, startCol: sc,
+			endLine: el, endCol: ec, numStmt: 1}
+	}
+	prof := &profile{mode: "set", blocks: []profileBlock{
+		block("b.go", 1, 1, 2, 1),
+		block("a.go", 10, 2, 11, 1),
+		block("a.go", 3, 5, 4, 1),
+		block("a.go", 3, 2, 9, 1),
+		block("a.go", 3, 2, 4, 1),
+	}}
+	want := []profileBlock{
+		block("a.go", 3, 2, 4, 1),
+		block("a.go", 3, 2, 9, 1),
+		block("a.go", 3, 5, 4, 1),
+		block("a.go", 10, 2, 11, 1),
+		block("b.go", 1, 1, 2, 1),
+	}
+	prof.sort()
+	if !reflect.DeepEqual(prof.blocks, want) {
+		t.Errorf("sort got: %v, want: %v", prof.blocks, want)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reporter writes a report of the merged coverage profile of a run
+type Reporter interface {
+	Report(prof *profile, run *runInfo) error
+}
+
+// runInfo is the metadata of a run that is passed to each Reporter
+type runInfo struct {
+	wd       string
+	resolver *pathResolver
+	duration time.Duration
+	flagSet  *flag.FlagSet
+	out      io.Writer
+	outErr   io.Writer
+}
+
+// reportSpec is a report requested with the -report flag
+type reportSpec struct {
+	name string
+	dest string
+}
+
+// reportFlag is a flag.Value that can be given multiple times to request
+// several reports
+type reportFlag []reportSpec
+
+// reporterMakers maps the name of each report format to a function that
+// makes a Reporter for it that writes to dest
+var reporterMakers = map[string]func(p *Program, dest string) Reporter{
+	"badge": func(p *Program, dest string) Reporter {
+		return badgeReporter{
+			filename:   dest,
+			label:      p.badgeLabel,
+			thresholds: p.badgeThresholds,
+			perPackage: p.badgePerPackage,
+		}
+	},
+	"codecov": func(p *Program, dest string) Reporter {
+		return codecovReporter{filename: dest}
+	},
+	"coveralls": func(p *Program, dest string) Reporter {
+		return coverallsReporter{endpoint: dest, getenv: os.Getenv}
+	},
+	"func": func(p *Program, dest string) Reporter {
+		return funcReporter{
+			filename:    dest,
+			sortBy:      p.funcSort,
+			format:      p.funcFormat,
+			minCoverage: p.funcMin,
+		}
+	},
+	"github-annotations": func(p *Program, dest string) Reporter {
+		return githubAnnotationsReporter{
+			filename:   dest,
+			base:       p.diffBaseRef(),
+			maxPerFile: p.annotationsMax,
+		}
+	},
+	"history": func(p *Program, dest string) Reporter {
+		return historyReporter{filename: dest, now: time.Now}
+	},
+	"html": func(p *Program, dest string) Reporter {
+		return htmlReporter{dir: dest}
+	},
+	"json-summary": func(p *Program, dest string) Reporter {
+		return jsonSummaryReporter{filename: dest}
+	},
+	"list-uncovered": func(p *Program, dest string) Reporter {
+		return uncoveredReporter{
+			filename: dest,
+			pkgs:     p.listPkgs,
+			glob:     p.listGlob,
+			minStmts: p.listMin,
+		}
+	},
+	"markdown": func(p *Program, dest string) Reporter {
+		return markdownReporter{
+			filename:    dest,
+			baseline:    p.baseline,
+			base:        p.diffBaseRef(),
+			readProfile: p.readProfileFile,
+			getenv:      os.Getenv,
+		}
+	},
+	"sarif": func(p *Program, dest string) Reporter {
+		return sarifReporter{filename: dest, by: p.sarifBy, base: p.diffBaseRef()}
+	},
+	"sonar": func(p *Program, dest string) Reporter {
+		return sonarReporter{filename: dest, baseDir: p.sonarBase}
+	},
+	"text": func(p *Program, dest string) Reporter {
+		return textReporter{filename: dest}
+	},
+}
+
+// reportNames returns the names of the report formats in order
+func reportNames() []string {
+	names := []string{}
+	for name := range reporterMakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *reportFlag) String() string {
+	if r == nil {
+		return ""
+	}
+	specs := make([]string, len(*r))
+	for i, s := range *r {
+		specs[i] = s.name + "=" + s.dest
+	}
+	return strings.Join(specs, ", ")
+}
+
+func (r *reportFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[1] == "" {
+		return fmt.Errorf("invalid report: %s", s)
+	}
+	if _, ok := reporterMakers[kv[0]]; !ok {
+		return fmt.Errorf("unknown report format: %s", kv[0])
+	}
+	*r = append(*r, reportSpec{name: kv[0], dest: kv[1]})
+	return nil
+}
+
+// reporters returns the Reporters requested on the command line.  The
+// options for single formats, such as -html, are aliases for -report and
+// the text profile is written to its usual file unless it is requested
+// with -report.
+func (p *Program) reporters() []Reporter {
+	specs := []reportSpec{}
+	hasText := false
+	for _, s := range p.report {
+		if s.name == "text" {
+			hasText = true
+		}
+	}
+	if !hasText {
+		specs = append(specs, reportSpec{name: "text", dest: p.outFilename()})
+	}
+	aliases := []reportSpec{
+		{name: "html", dest: p.html},
+		{name: "func", dest: p.funcOut},
+		{name: "json-summary", dest: p.jsonSummary},
+		{name: "sonar", dest: p.sonar},
+		{name: "codecov", dest: p.codecov},
+		{name: "markdown", dest: p.markdown},
+		{name: "badge", dest: p.badge},
+		{name: "history", dest: p.history},
+		{name: "sarif", dest: p.sarif},
+	}
+	if p.ghAnnotations {
+		aliases = append(aliases,
+			reportSpec{name: "github-annotations", dest: "-"})
+	}
+	if p.listUncovered {
+		aliases = append(aliases,
+			reportSpec{name: "list-uncovered", dest: "-"})
+	}
+	if p.coveralls {
+		aliases = append(aliases,
+			reportSpec{name: "coveralls", dest: p.coverallsURL})
+	}
+	for _, s := range aliases {
+		if s.dest != "" {
+			specs = append(specs, s)
+		}
+	}
+	specs = append(specs, p.report...)
+
+	r := make([]Reporter, len(specs))
+	for i, s := range specs {
+		r[i] = reporterMakers[s.name](p, s.dest)
+	}
+	return r
+}
+
+// diffBaseRef returns the git ref that changed lines are found from,
+// defaulting to the base branch of a GitHub Actions pull request
+func (p *Program) diffBaseRef() string {
+	if p.diffBase == "" && os.Getenv("GITHUB_BASE_REF") != "" {
+		return "origin/" + os.Getenv("GITHUB_BASE_REF")
+	}
+	return p.diffBase
+}
+
+// writeReportFile calls write with out if filename is '-', otherwise with
+// the file filename
+func writeReportFile(
+	filename string,
+	out io.Writer,
+	write func(io.Writer) error,
+) error {
+	if filename == "-" {
+		return write(out)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	return f.Close()
+}
+
+// textReporter writes the profile in the format used by go test, with
+// '-' meaning stdout
+type textReporter struct {
+	filename string
+}
+
+func (r textReporter) Report(prof *profile, run *runInfo) error {
+	if r.filename == "-" {
+		return prof.write(run.out)
+	}
+	return writeProfileFile(r.filename, prof)
+}
+
+type htmlReporter struct {
+	dir string
+}
+
+func (r htmlReporter) Report(prof *profile, run *runInfo) error {
+	return writeHTMLReport(r.dir, prof, run.resolver)
+}
+
+type jsonSummaryReporter struct {
+	filename string
+}
+
+func (r jsonSummaryReporter) Report(prof *profile, run *runInfo) error {
+	summary := makeJSONSummary(prof, run.duration, run.flagSet)
+	return writeReportFile(r.filename, run.out, func(w io.Writer) error {
+		return writeJSON(w, summary)
+	})
+}
+
+// sonarReporter writes a SonarQube report with paths relative to baseDir
+// or the working directory if it is empty
+type sonarReporter struct {
+	filename string
+	baseDir  string
+}
+
+func (r sonarReporter) Report(prof *profile, run *runInfo) error {
+	baseDir := run.wd
+	if r.baseDir != "" {
+		var err error
+		baseDir, err = filepath.Abs(r.baseDir)
+		if err != nil {
+			return err
+		}
+	}
+	return writeSonarFile(r.filename, run.out, prof, run.resolver, baseDir)
+}
+
+type codecovReporter struct {
+	filename string
+}
+
+func (r codecovReporter) Report(prof *profile, run *runInfo) error {
+	return writeCodecovFile(r.filename, run.out, prof, run.resolver, run.wd)
+}
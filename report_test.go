@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReportFlagSet(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    reportSpec
+		wantErr string
+	}{
+		{in: "text=out.coverprofile",
+			want: reportSpec{name: "text", dest: "out.coverprofile"}},
+		{in: "html=a=b", want: reportSpec{name: "html", dest: "a=b"}},
+		{in: "html", wantErr: "invalid report: html"},
+		{in: "html=", wantErr: "invalid report: html="},
+		{in: "bob=x", wantErr: "unknown report format: bob"},
+	}
+	for _, c := range cases {
+		var r reportFlag
+		err := r.Set(c.in)
+		if c.wantErr != "" {
+			if err == nil || err.Error() != c.wantErr {
+				t.Errorf("Set(%s) err: %v, want: %s", c.in, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%s) err: %s", c.in, err)
+			continue
+		}
+		if len(r) != 1 || r[0] != c.want {
+			t.Errorf("Set(%s) got: %v, want: %v", c.in, r, c.want)
+		}
+	}
+}
+
+func TestReporters(t *testing.T) {
+	cases := []struct {
+		p    *Program
+		want []Reporter
+	}{
+		{p: &Program{},
+			want: []Reporter{textReporter{filename: outFilename}}},
+		{p: &Program{
+			html: "cov",
+			report: reportFlag{
+				{name: "text", dest: "a.out"},
+				{name: "codecov", dest: "codecov.json"},
+			}},
+			want: []Reporter{
+				htmlReporter{dir: "cov"},
+				textReporter{filename: "a.out"},
+				codecovReporter{filename: "codecov.json"},
+			}},
+	}
+	for _, c := range cases {
+		got := c.p.reporters()
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("reporters got: %v, want: %v", got, c.want)
+		}
+	}
+}
+
+func TestRun_report(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	textFilename := filepath.Join(tmpDir, "a.coverprofile")
+	htmlDir := filepath.Join(tmpDir, "html")
+	cmdArgs := []string{
+		os.Args[0],
+		"-report", "text=" + textFilename,
+		"-report", "html=" + htmlDir,
+	}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir(filepath.Join("fixtures", "good")); err != nil {
+		t.Fatalf("ChDir err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+	for _, filename := range []string{
+		textFilename,
+		filepath.Join(htmlDir, "index.html"),
+	} {
+		if _, err := os.Stat(filename); err != nil {
+			t.Errorf("Stat(%s) err: %s", filename, err)
+		}
+	}
+	if _, err := os.Stat(outFilename); !os.IsNotExist(err) {
+		t.Errorf("Stat(%s) err: %v, want not exist", outFilename, err)
+	}
+}
+
+func TestReport_stdout(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	file := filepath.Join(wd, "testdata", "funcs", "funcs.go")
+	prof := &profile{mode: "count", blocks: []profileBlock{
+		{file: file, startLine: 16, startCol: 18, endLine: 18, endCol: 2, numStmt: 1, count: 2},
+		{file: file, startLine: 12, startCol: 24, endLine: 14, endCol: 2, numStmt: 1, count: 0},
+	}}
+	cases := []struct {
+		name     string
+		wantPart string
+	}{
+		{name: "badge", wantPart: "<svg "},
+		{name: "codecov", wantPart: `"coverage": {`},
+		{name: "history", wantPart: `"total":`},
+		{name: "json-summary", wantPart: `"packages": [`},
+		{name: "sonar", wantPart: "<coverage "},
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("ChDir(%s) err: %s", tmpDir, err)
+	}
+	p := &Program{badgeLabel: "coverage"}
+	for _, c := range cases {
+		var out bytes.Buffer
+		run := &runInfo{
+			wd:       wd,
+			resolver: newPathResolver(),
+			flagSet:  flag.NewFlagSet("roveralls", flag.ContinueOnError),
+			out:      &out,
+			outErr:   &bytes.Buffer{},
+		}
+		if err := reporterMakers[c.name](p, "-").Report(prof, run); err != nil {
+			t.Errorf("Report(%s) err: %s", c.name, err)
+			continue
+		}
+		if !strings.Contains(out.String(), c.wantPart) {
+			t.Errorf("Report(%s) got: %s, want part: %s", c.name, out.String(),
+				c.wantPart)
+		}
+		if _, err := os.Stat("-"); err == nil {
+			t.Errorf("Report(%s) wrote a file named: -", c.name)
+			os.Remove("-")
+		}
+	}
+
+	p.badgePerPackage = true
+	err = reporterMakers["badge"](p, "-").Report(prof, &runInfo{out: &bytes.Buffer{}})
+	wantErr := "can't write badges per package to stdout"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("Report(badge) err: %v, want: %s", err, wantErr)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathResolver finds the source files referred to in coverage profiles
+type pathResolver struct {
+	pkgDirs map[string]string
+	// sources maps the files of a rewritten profile to the files that
+	// they were rewritten from
+	sources map[string]string
+}
+
+func newPathResolver() *pathResolver {
+	return &pathResolver{
+		pkgDirs: map[string]string{},
+		sources: map[string]string{},
+	}
+}
+
+// resolve returns the absolute filesystem path of file from a coverage
+// profile.  file is normally an import path followed by a filename, but
+// may also be a filesystem path or a path rewritten by a pathRewriter
+// using this resolver.
+func (r *pathResolver) resolve(file string) (string, error) {
+	if source, ok := r.sources[file]; ok {
+		file = source
+	}
+	if filepath.IsAbs(file) {
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	// Packages outside of GOPATH and modules are given an import path of
+	// their directory prefixed with '_'
+	if strings.HasPrefix(file, "_/") {
+		if _, err := os.Stat(file[1:]); err == nil {
+			return file[1:], nil
+		}
+	}
+	if _, err := os.Stat(file); err == nil {
+		return filepath.Abs(file)
+	}
+
+	pkg := path.Dir(file)
+	dir, ok := r.pkgDirs[pkg]
+	if !ok {
+		dir = findPackageDir(pkg)
+		r.pkgDirs[pkg] = dir
+	}
+	if dir == "" {
+		return "", fmt.Errorf("can't find source file for: %s", file)
+	}
+	return filepath.Join(dir, path.Base(file)), nil
+}
+
+// relPath returns the filesystem path of file from a coverage profile
+// relative to baseDir, using forward slashes
+func (r *pathResolver) relPath(baseDir string, file string) (string, error) {
+	filename, err := r.resolve(file)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(baseDir, filename)
+	if err != nil {
+		return "", fmt.Errorf("can't make path relative: %s", filename)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// findPackageDir returns the directory containing the package with
+// importPath or "" if it can't be found
+func findPackageDir(importPath string) string {
+	var cmdOut bytes.Buffer
+	cmd := exec.Command("go", "list", "-find", "-f", "{{.Dir}}", importPath)
+	cmd.Stdout = &cmdOut
+	if err := cmd.Run(); err == nil {
+		if dir := strings.TrimSpace(cmdOut.String()); dir != "" {
+			return dir
+		}
+	}
+	for _, gopath := range filepath.SplitList(os.Getenv("GOPATH")) {
+		dir := filepath.Join(gopath, "src", filepath.FromSlash(importPath))
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// prefixMapping replaces the prefix old of a path with new
+type prefixMapping struct {
+	old string
+	new string
+}
+
+// prefixMapFlag is a flag.Value that can be given multiple times to build
+// up a list of prefix mappings
+type prefixMapFlag []prefixMapping
+
+func (m *prefixMapFlag) String() string {
+	if m == nil {
+		return ""
+	}
+	mappings := make([]string, len(*m))
+	for i, pm := range *m {
+		mappings[i] = pm.old + "=" + pm.new
+	}
+	return strings.Join(mappings, ", ")
+}
+
+func (m *prefixMapFlag) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("invalid path prefix map: %s", s)
+	}
+	*m = append(*m, prefixMapping{old: kv[0], new: kv[1]})
+	return nil
+}
+
+// pathRewriter rewrites the files in a profile to a path style and then
+// applies any prefix mappings
+type pathRewriter struct {
+	style     string
+	prefixMap []prefixMapping
+	baseDir   string
+	resolver  *pathResolver
+}
+
+var validPathStyles = map[string]bool{
+	"import":   true,
+	"relative": true,
+	"absolute": true,
+}
+
+// newPathRewriter returns a pathRewriter for the path style and prefix map
+// given on the command line, where relative paths are relative to baseDir
+func (p *Program) newPathRewriter(baseDir string) (*pathRewriter, error) {
+	if !validPathStyles[p.pathStyle] {
+		return nil, fmt.Errorf("invalid path-style '%s'", p.pathStyle)
+	}
+	return &pathRewriter{
+		style:     p.pathStyle,
+		prefixMap: p.pathPrefixMap,
+		baseDir:   baseDir,
+		resolver:  newPathResolver(),
+	}, nil
+}
+
+// rewrite returns the new path for file
+func (r *pathRewriter) rewrite(file string) (string, error) {
+	newFile := file
+	switch r.style {
+	case "relative", "absolute":
+		var err error
+		if r.style == "relative" {
+			newFile, err = r.resolver.relPath(r.baseDir, file)
+		} else {
+			newFile, err = r.resolver.resolve(file)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, pm := range r.prefixMap {
+		if pm.matches(newFile) {
+			return pm.new + strings.TrimPrefix(newFile, pm.old), nil
+		}
+	}
+	return newFile, nil
+}
+
+// matches returns true if file starts with the whole directories of the
+// prefix to be replaced
+func (pm prefixMapping) matches(file string) bool {
+	if !strings.HasPrefix(file, pm.old) {
+		return false
+	}
+	return len(file) == len(pm.old) || strings.HasSuffix(pm.old, "/") ||
+		file[len(pm.old)] == '/'
+}
+
+// rewriteProfile rewrites the files in prof
+func (r *pathRewriter) rewriteProfile(prof *profile) (*profile, error) {
+	if r.style == "import" && len(r.prefixMap) == 0 {
+		return prof, nil
+	}
+	files := map[string]string{}
+	rewritten := &profile{mode: prof.mode, blocks: make([]profileBlock, len(prof.blocks))}
+	for i, b := range prof.blocks {
+		newFile, ok := files[b.file]
+		if !ok {
+			var err error
+			newFile, err = r.rewrite(b.file)
+			if err != nil {
+				return nil, err
+			}
+			files[b.file] = newFile
+			if _, ok := r.resolver.sources[newFile]; !ok {
+				r.resolver.sources[newFile] = b.file
+			}
+		}
+		b.file = newFile
+		rewritten.blocks[i] = b
+	}
+	// Different paths may have been rewritten to the same path
+	return mergeProfiles(prof.mode, rewritten)
+}
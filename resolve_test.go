@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathResolverResolve(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := filepath.Join(wd, "fixtures", "good", "good.go")
+	cases := []struct {
+		file string
+		want string
+	}{
+		{file: "github.com/lawrencewoodman/roveralls/fixtures/good/good.go",
+			want: good,
+		},
+		{file: good, want: good},
+		{file: "_" + filepath.ToSlash(good), want: good},
+		{file: filepath.Join("fixtures", "good", "good.go"), want: good},
+	}
+	r := newPathResolver()
+	for _, c := range cases {
+		got, err := r.resolve(c.file)
+		if err != nil {
+			t.Errorf("resolve(%s) err: %s", c.file, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("resolve(%s) got: %s, want: %s", c.file, got, c.want)
+		}
+	}
+	if _, err := r.resolve("example.com/nonexistant/a.go"); err == nil {
+		t.Errorf("resolve(example.com/nonexistant/a.go) got no error")
+	}
+}
+
+func TestPathRewriterRewrite(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "github.com/lawrencewoodman/roveralls/fixtures/good/good.go"
+	good := filepath.Join(wd, "fixtures", "good", "good.go")
+	cases := []struct {
+		style     string
+		prefixMap []prefixMapping
+		want      string
+	}{
+		{style: "import", want: file},
+		{style: "relative", want: "fixtures/good/good.go"},
+		{style: "absolute", want: good},
+		{style: "import",
+			prefixMap: []prefixMapping{
+				{old: "example.com/", new: "x/"},
+				{old: "github.com/lawrencewoodman/roveralls/", new: "src/"},
+			},
+			want: "src/fixtures/good/good.go",
+		},
+		{style: "relative",
+			prefixMap: []prefixMapping{{old: "fixtures/", new: "/build/"}},
+			want:      "/build/good/good.go",
+		},
+	}
+	for _, c := range cases {
+		r := &pathRewriter{
+			style:     c.style,
+			prefixMap: c.prefixMap,
+			baseDir:   wd,
+			resolver:  newPathResolver(),
+		}
+		got, err := r.rewrite(file)
+		if err != nil {
+			t.Errorf("rewrite(%s) style: %s, err: %s", file, c.style, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("rewrite(%s) style: %s, got: %s, want: %s",
+				file, c.style, got, c.want)
+		}
+	}
+}
+
+func TestPrefixMappingMatches(t *testing.T) {
+	cases := []struct {
+		old  string
+		file string
+		want bool
+	}{
+		{old: "github.com/org/repo", file: "github.com/org/repo/a.go", want: true},
+		{old: "github.com/org/repo/", file: "github.com/org/repo/a.go", want: true},
+		{old: "github.com/org/repo", file: "github.com/org/repo", want: true},
+		{old: "github.com/org/repo", file: "github.com/org/repo2/a.go", want: false},
+		{old: "github.com/org/repo", file: "github.com/org/rep", want: false},
+	}
+	for _, c := range cases {
+		pm := prefixMapping{old: c.old, new: "x"}
+		got := pm.matches(c.file)
+		if got != c.want {
+			t.Errorf("matches(%s) old: %s, got: %t, want: %t",
+				c.file, c.old, got, c.want)
+		}
+	}
+}
+
+func TestPrefixMapFlagSet(t *testing.T) {
+	var m prefixMapFlag
+	if err := m.Set("a/b=c"); err != nil {
+		t.Fatalf("Set err: %s", err)
+	}
+	if err := m.Set("=c"); err == nil {
+		t.Errorf("Set(=c) got no error")
+	}
+	if got := m.String(); got != "a/b=c" {
+		t.Errorf("String() got: %s, want: a/b=c", got)
+	}
+}
+
+func TestRun_pathStyle(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{os.Args[0],
+		"-path-style", "relative",
+		"-path-prefix-map", "good/=pkg/good/",
+		"-func", "-",
+	}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir("fixtures"); err != nil {
+		t.Fatalf("ChDir(fixtures) err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+	b, err := ioutil.ReadFile(outFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"\npkg/good/good.go:", "\ngood2/good2.go:"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("profile doesn't contain: %s, got: %s", want, b)
+		}
+	}
+	// The reports must find the source of the rewritten paths
+	if !strings.Contains(gotOut.String(), "pkg/good/good.go:") {
+		t.Errorf("Run: func report doesn't contain: pkg/good/good.go:, got: %s",
+			gotOut.String())
+	}
+}
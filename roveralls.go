@@ -5,15 +5,18 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"go/build"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"time"
 )
 
 // This is a horrible kludge so that errors can be tested properly
@@ -25,7 +28,7 @@ var Usage = func() {
 }
 
 func subUsage(out io.Writer) {
-	fmt.Fprintf(out, usageMsg())
+	fmt.Fprint(out, usageMsg())
 }
 
 func usageMsg() string {
@@ -34,6 +37,13 @@ func usageMsg() string {
 roveralls runs coverage tests on a package and all its sub-packages.  The
 coverage profile is output as a single file called 'roveralls.coverprofile'
 for use by tools such as goveralls.
+
+Subcommands:
+  merge     Merge existing coverage profiles into one
+  validate  Check that coverage profiles are well-formed
+  history   Show the trend of the coverage recorded with -history
+
+Run 'roveralls <subcommand> -help' for help on a subcommand.
 `
 	fmt.Fprintf(&b, "%s\n", desc)
 	fmt.Fprintf(&b, "Usage:\n")
@@ -57,14 +67,34 @@ const (
 	outFilename    = "roveralls.coverprofile"
 )
 
+// maxDigestLines is the maximum number of output lines shown for each
+// failing test in a goTestError
+const maxDigestLines = 10
+
 type goTestError struct {
-	stderr string
-	stdout string
+	pkg      string
+	failures []testFailure
+	logFile  string
+	stderr   string
+	stdout   string
 }
 
+// Error returns a digest of the failing tests if there are any, otherwise
+// it returns all the output from go test
 func (e goTestError) Error() string {
-	return fmt.Sprintf("error from go test: %s\noutput: %s",
-		e.stderr, e.stdout)
+	if len(e.failures) == 0 {
+		return fmt.Sprintf("error from go test: %s\noutput: %s",
+			e.stderr, e.stdout)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "error from go test for package: %s\n", e.pkg)
+	for _, f := range e.failures {
+		b.WriteString(f.digest(maxDigestLines))
+	}
+	if e.logFile != "" {
+		fmt.Fprintf(&b, "full log: %s\n", e.logFile)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
 }
 
 type walkingError struct {
@@ -79,17 +109,70 @@ func (e walkingError) Error() string {
 
 // Program contains the configuration and state of the program
 type Program struct {
-	ignore  string
-	cover   string
-	help    bool
-	short   bool
-	verbose bool
-	ignores map[string]bool
-	cmdArgs []string
-	flagSet *flag.FlagSet
-	out     io.Writer
-	outErr  io.Writer
-	gopath  string
+	ignore          string
+	cover           string
+	help            bool
+	short           bool
+	verbose         bool
+	includeUntested bool
+	failureLogs     string
+	junit           string
+	html            string
+	funcOut         string
+	funcSort        string
+	funcFormat      string
+	funcMin         float64
+	jsonSummary     string
+	codecov         string
+	ghAnnotations   bool
+	annotationsMax  int
+	diffBase        string
+	markdown        string
+	baseline        string
+	badge           string
+	badgeLabel      string
+	badgeColours    string
+	badgeThresholds []badgeThreshold
+	badgePerPackage bool
+	history         string
+	historyRuns     int
+	historyHTML     string
+	coveralls       bool
+	coverallsURL    string
+	sonar           string
+	report          reportFlag
+	sonarBase       string
+	sarif           string
+	sarifBy         string
+	listUncovered   bool
+	listPkgs        string
+	listGlob        string
+	listMin         int
+	start           time.Time
+	matrix          matrixFlag
+	mergeOutput     string
+	skipSource      bool
+	pathStyle       string
+	dropEmpty       bool
+	outDir          string
+	outIndex        []outDirIndexEntry
+	pathPrefixMap   prefixMapFlag
+	shard           string
+	shardSpec       shardSpec
+	shardOf         map[string]int
+	timingFiles     string
+	timings         map[string]float64
+	covDataDirs     string
+	coverScript     string
+	ignores         map[string]bool
+	untested        []string
+	testEvents      []testEvent
+	cmdArgs         []string
+	flagSet         *flag.FlagSet
+	in              io.Reader
+	out             io.Writer
+	outErr          io.Writer
+	gopath          string
 }
 
 func initProgram(
@@ -98,12 +181,29 @@ func initProgram(
 	outErr io.Writer,
 	gopath string,
 ) {
-	program = &Program{out: out, outErr: outErr, cmdArgs: cmdArgs, gopath: gopath}
+	program = &Program{
+		timings: map[string]float64{},
+		in:      os.Stdin,
+		out:     out,
+		outErr:  outErr,
+		cmdArgs: cmdArgs,
+		gopath:  gopath,
+	}
 	program.initFlagSet()
 }
 
 // Run starts the program
 func (p *Program) Run() int {
+	if len(p.cmdArgs) > 1 {
+		switch p.cmdArgs[1] {
+		case "merge":
+			return p.runMerge(p.cmdArgs[2:])
+		case "validate":
+			return p.runValidate(p.cmdArgs[2:])
+		case "history":
+			return p.runHistory(p.cmdArgs[2:])
+		}
+	}
 	if err := p.flagSet.Parse(p.cmdArgs[1:]); err != nil {
 		return 1
 	}
@@ -126,7 +226,12 @@ func (p *Program) Run() int {
 	return 0
 }
 
+// ignoreDir returns true if the directory relDir is in -ignore or, as
+// with go, is named testdata
 func (p *Program) ignoreDir(relDir string) bool {
+	if filepath.Base(relDir) == "testdata" {
+		return true
+	}
 	_, ignore := p.ignores[relDir]
 	return ignore
 }
@@ -140,13 +245,241 @@ func (p *Program) initFlagSet() {
 		"count",
 		"Mode to run when testing files: `count,set,atomic`",
 	)
+	p.flagSet.StringVar(
+		&p.badge,
+		"badge",
+		"",
+		"Write an SVG badge of the total coverage to `filename`, '-' for stdout",
+	)
+	p.flagSet.StringVar(
+		&p.badgeColours,
+		"badge-colours",
+		defaultBadgeColours,
+		"Colour of the badge from each percentage up: `percent:colour,...` where colour is a name or #hex",
+	)
+	p.flagSet.StringVar(
+		&p.badgeLabel,
+		"badge-label",
+		"coverage",
+		"Label `text` of the badge",
+	)
+	p.flagSet.BoolVar(
+		&p.badgePerPackage,
+		"badge-per-package",
+		false,
+		"Also write a badge for each top-level package, named after the package",
+	)
+	p.flagSet.StringVar(
+		&p.baseline,
+		"baseline",
+		"",
+		"Coverage profile `filename` to compare the coverage with in the Markdown report",
+	)
+	p.flagSet.StringVar(
+		&p.codecov,
+		"codecov",
+		"",
+		"Write a Codecov JSON coverage report to `filename`, '-' for stdout",
+	)
+	p.flagSet.BoolVar(
+		&p.coveralls,
+		"coveralls",
+		false,
+		"Upload the coverage to Coveralls, using the repo token in COVERALLS_REPO_TOKEN",
+	)
+	p.flagSet.StringVar(
+		&p.coverallsURL,
+		"coveralls-endpoint",
+		defaultCoverallsEndpoint,
+		"The `url` of the Coveralls API to upload to",
+	)
+	p.flagSet.StringVar(
+		&p.covDataDirs,
+		"covdata",
+		"",
+		"Comma separated list of GOCOVERDIR directories to merge into the profile: `dir1,dir2,...`",
+	)
+	p.flagSet.StringVar(
+		&p.coverScript,
+		"cover-script",
+		"",
+		"Build the main packages with -cover and run `script` against them, merging the coverage into the profile",
+	)
+	p.flagSet.BoolVar(
+		&p.dropEmpty,
+		"drop-empty",
+		false,
+		"Drop blocks without any statements from the profile",
+	)
+	p.flagSet.StringVar(
+		&p.diffBase,
+		"diff-base",
+		"",
+		"Git `ref` that changed lines, including uncommitted ones, are found from its merge base with HEAD (default origin/$GITHUB_BASE_REF if set)",
+	)
+	p.flagSet.StringVar(
+		&p.failureLogs,
+		"failure-logs",
+		"",
+		"Write the full go test logs of failing packages to `dir`",
+	)
+	p.flagSet.StringVar(
+		&p.funcOut,
+		"func",
+		"",
+		"Write the coverage of each function to `filename`, '-' for stdout",
+	)
+	p.flagSet.StringVar(
+		&p.funcFormat,
+		"func-format",
+		"text",
+		"Format of the function coverage report: `text,json`",
+	)
+	p.flagSet.Float64Var(
+		&p.funcMin,
+		"func-min",
+		0,
+		"Only report functions with at least `percent` coverage",
+	)
+	p.flagSet.StringVar(
+		&p.funcSort,
+		"func-sort",
+		"file",
+		"Order of the function coverage report: `file,name,coverage,statements`",
+	)
 	p.flagSet.StringVar(
 		&p.ignore,
 		"ignore",
 		defaultIgnores,
-		"Comma separated list of directory names to ignore: `dir1,dir2,...`",
+		"Comma separated list of directory names to ignore, as well as testdata: `dir1,dir2,...`",
+	)
+	p.flagSet.BoolVar(
+		&p.ghAnnotations,
+		"github-annotations",
+		false,
+		"Output GitHub Actions warnings for the uncovered lines changed since -diff-base",
+	)
+	p.flagSet.IntVar(
+		&p.annotationsMax,
+		"github-annotations-max",
+		10,
+		"Maximum `number` of GitHub Actions warnings for each file",
+	)
+	p.flagSet.StringVar(
+		&p.history,
+		"history",
+		"",
+		"Append a record of the coverage to the history file `filename`, '-' for stdout",
+	)
+	p.flagSet.StringVar(
+		&p.html,
+		"html",
+		"",
+		"Write an HTML coverage report to `dir`",
+	)
+	p.flagSet.BoolVar(
+		&p.includeUntested,
+		"include-untested",
+		false,
+		"Include packages without test files as zero coverage",
+	)
+	p.flagSet.StringVar(
+		&p.jsonSummary,
+		"json-summary",
+		"",
+		"Write a JSON summary of the coverage and run to `filename`, '-' for stdout",
+	)
+	p.flagSet.StringVar(
+		&p.junit,
+		"junit",
+		"",
+		"Write a JUnit XML report of the tests run to `filename`",
+	)
+	p.flagSet.BoolVar(
+		&p.listUncovered,
+		"list-uncovered",
+		false,
+		"List each uncovered block as 'path:line:col: uncovered (N statements)'",
+	)
+	p.flagSet.StringVar(
+		&p.listGlob,
+		"list-uncovered-glob",
+		"",
+		"Only list uncovered blocks in files matching `glob`, matched against the name of the file if it has no '/'",
+	)
+	p.flagSet.IntVar(
+		&p.listMin,
+		"list-uncovered-min",
+		0,
+		"Only list uncovered blocks with at least `n` statements",
+	)
+	p.flagSet.StringVar(
+		&p.listPkgs,
+		"list-uncovered-pkg",
+		"",
+		"Only list uncovered blocks in the packages: `pkg1,pkg2/...`",
+	)
+	p.flagSet.Var(
+		&p.matrix,
+		"matrix",
+		"Run the tests under a configuration, may be given more than once: `'tags=t1,t2 goarch=arch env=NAME=VALUE'` or 'default'",
+	)
+	p.flagSet.StringVar(
+		&p.sarif,
+		"sarif",
+		"",
+		"Write a SARIF log of the uncovered code in the files changed since -diff-base, or all files, to `filename`, '-' for stdout",
+	)
+	p.flagSet.StringVar(
+		&p.sarifBy,
+		"sarif-by",
+		"block",
+		"Write a SARIF result for each uncovered: `block,func`",
+	)
+	p.flagSet.StringVar(
+		&p.sonar,
+		"sonar",
+		"",
+		"Write a SonarQube generic coverage XML report to `filename`, '-' for stdout",
+	)
+	p.flagSet.StringVar(
+		&p.sonarBase,
+		"sonar-base",
+		"",
+		"Project base `dir` that the paths in the SonarQube report are relative to (default working directory)",
+	)
+	p.flagSet.StringVar(
+		&p.markdown,
+		"markdown",
+		"",
+		"Write a Markdown report to `filename`, '-' for stdout, also appending it to $GITHUB_STEP_SUMMARY if set",
+	)
+	p.flagSet.StringVar(
+		&p.timingFiles,
+		"timings",
+		"",
+		"Comma separated list of timings files used to balance shards: `file1,file2,...`",
 	)
 	p.flagSet.BoolVar(&p.verbose, "v", false, "Verbose output")
+	p.flagSet.StringVar(
+		&p.outDir,
+		"outdir",
+		"",
+		"Keep the raw profile, output and timing of each package in `dir`",
+	)
+	p.initPathFlags(p.flagSet)
+	p.flagSet.Var(
+		&p.report,
+		"report",
+		"Write a report, may be given more than once: `name=dest` where name is one of: "+
+			strings.Join(reportNames(), ","),
+	)
+	p.flagSet.StringVar(
+		&p.shard,
+		"shard",
+		"",
+		"Only test the packages in shard `i/n`, writing the profile and timings to files named after the shard",
+	)
 	p.flagSet.BoolVar(
 		&p.short,
 		"short",
@@ -156,6 +489,21 @@ func (p *Program) initFlagSet() {
 	p.flagSet.BoolVar(&p.help, "help", false, "Display this help")
 }
 
+// initPathFlags adds the flags controlling the paths in profiles to fs
+func (p *Program) initPathFlags(fs *flag.FlagSet) {
+	fs.StringVar(
+		&p.pathStyle,
+		"path-style",
+		"import",
+		"Style of the paths to source files in the profile: `import,relative,absolute`",
+	)
+	fs.Var(
+		&p.pathPrefixMap,
+		"path-prefix-map",
+		"Replace the prefix of paths in the profile, may be given more than once: `old=new`",
+	)
+}
+
 // returns true if a problem, else false
 func (p *Program) handleGOPATH() bool {
 	gopath := filepath.Clean(p.gopath)
@@ -184,13 +532,116 @@ func (p *Program) handleFlags() bool {
 	for _, v := range arr {
 		p.ignores[v] = true
 	}
+
+	if p.outDir != "" {
+		// go test is run from each package's directory so the path must
+		// be absolute
+		outDir, err := filepath.Abs(p.outDir)
+		if err != nil {
+			fmt.Fprintf(p.outErr, "invalid outdir '%s'\n", p.outDir)
+			return true
+		}
+		p.outDir = outDir
+	}
+
+	if p.failureLogs != "" {
+		// go test is run from each package's directory so the path must
+		// be absolute
+		failureLogs, err := filepath.Abs(p.failureLogs)
+		if err != nil {
+			fmt.Fprintf(p.outErr, "invalid failure-logs '%s'\n", p.failureLogs)
+			return true
+		}
+		p.failureLogs = failureLogs
+	}
+
+	if !validPathStyles[p.pathStyle] {
+		fmt.Fprintf(p.outErr, "invalid path-style '%s'\n", p.pathStyle)
+		subUsage(p.outErr)
+		return true
+	}
+
+	if !validFuncSorts[p.funcSort] {
+		fmt.Fprintf(p.outErr, "invalid func-sort '%s'\n", p.funcSort)
+		subUsage(p.outErr)
+		return true
+	}
+	if !validFuncFormats[p.funcFormat] {
+		fmt.Fprintf(p.outErr, "invalid func-format '%s'\n", p.funcFormat)
+		subUsage(p.outErr)
+		return true
+	}
+
+	if !validSarifBys[p.sarifBy] {
+		fmt.Fprintf(p.outErr, "invalid sarif-by '%s'\n", p.sarifBy)
+		subUsage(p.outErr)
+		return true
+	}
+
+	if _, err := path.Match(p.listGlob, ""); err != nil {
+		fmt.Fprintf(p.outErr, "invalid list-uncovered-glob '%s'\n", p.listGlob)
+		subUsage(p.outErr)
+		return true
+	}
+
+	badgeThresholds, err := parseBadgeColours(p.badgeColours)
+	if err != nil {
+		fmt.Fprintln(p.outErr, err)
+		subUsage(p.outErr)
+		return true
+	}
+	p.badgeThresholds = badgeThresholds
+
+	if p.shard != "" {
+		shardSpec, err := parseShard(p.shard)
+		if err != nil {
+			fmt.Fprintln(p.outErr, err)
+			subUsage(p.outErr)
+			return true
+		}
+		p.shardSpec = shardSpec
+	}
 	return false
 }
 
-var modeRegexp = regexp.MustCompile("mode: [a-z]+\n")
+// outFilename returns the name of the file to write the coverage profile to
+func (p *Program) outFilename() string {
+	if p.shard != "" {
+		return p.shardSpec.filename("coverprofile")
+	}
+	return outFilename
+}
+
+// assignShard works out which packages are in each shard
+func (p *Program) assignShard(wd string) error {
+	pkgs, err := p.discoverPackages(wd)
+	if err != nil {
+		return err
+	}
+	timingFiles := []string{}
+	if p.timingFiles != "" {
+		timingFiles = strings.Split(p.timingFiles, ",")
+	}
+	timings, err := readTimings(timingFiles)
+	if err != nil {
+		return err
+	}
+	p.shardOf = assignShards(pkgs, timings, p.shardSpec.count)
+	return nil
+}
+
+// matrixEntries returns the configurations to run the tests under
+func (p *Program) matrixEntries() []matrixEntry {
+	if len(p.matrix) == 0 {
+		return []matrixEntry{{}}
+	}
+	return p.matrix
+}
 
 func (p *Program) testCoverage() error {
-	var buff bytes.Buffer
+	p.start = time.Now()
+	entries := p.matrixEntries()
+	buffs := make([]bytes.Buffer, len(entries))
 
 	wd, err := os.Getwd()
 	if err != nil {
@@ -199,28 +650,128 @@ func (p *Program) testCoverage() error {
 	if p.verbose {
 		fmt.Fprintln(p.out, "Working dir:", wd)
 	}
+	if p.shard != "" {
+		if err := p.assignShard(wd); err != nil {
+			return walkingError{
+				dir: wd,
+				err: err,
+			}
+		}
+	}
 
-	walker := p.makeWalker(wd, &buff)
-	if err := filepath.Walk(wd, walker); err != nil {
+	walker := p.makeWalker(wd, buffs)
+	walkErr := filepath.Walk(wd, walker)
+	// The reports are written even if the tests failed so that the
+	// failures can be seen
+	if p.junit != "" {
+		if err := p.writeJUnitFile(p.junit); err != nil && walkErr == nil {
+			return err
+		}
+	}
+	if p.outDir != "" {
+		if err := p.writeOutDirIndex(); err != nil && walkErr == nil {
+			return err
+		}
+	}
+	if walkErr != nil {
 		return walkingError{
 			dir: wd,
-			err: err,
+			err: walkErr,
 		}
 	}
 
-	final := buff.String()
-	final = modeRegexp.ReplaceAllString(final, "")
-	final = fmt.Sprintf("mode: %s\n%s", p.cover, final)
+	profs := make([]*profile, len(entries))
+	for i := range buffs {
+		prof, err := parseProfile(&buffs[i])
+		if err != nil {
+			return fmt.Errorf("error parsing go test coverage profile: %s", err)
+		}
+		prof.dedupe()
+		profs[i], err = mergeProfiles(p.cover, prof)
+		if err != nil {
+			return err
+		}
+	}
+	final, err := mergeProfiles(p.cover, profs...)
+	if err != nil {
+		return err
+	}
+	if p.covDataDirs != "" || p.coverScript != "" {
+		integration, err := p.integrationProfile(wd)
+		if err != nil {
+			return err
+		}
+		final, err = mergeProfiles(p.cover, final, integration)
+		if err != nil {
+			return err
+		}
+	}
+
+	rewriter, err := p.newPathRewriter(wd)
+	if err != nil {
+		return err
+	}
+	final, err = rewriter.rewriteProfile(final)
+	if err != nil {
+		return err
+	}
+	final.sort()
+	if p.dropEmpty {
+		final.dropEmpty()
+	}
 
-	if err := ioutil.WriteFile(outFilename, []byte(final), 0644); err != nil {
-		return fmt.Errorf("error writing to: %s, %s", outFilename, err)
+	run := &runInfo{
+		wd:       wd,
+		resolver: rewriter.resolver,
+		duration: time.Since(p.start),
+		flagSet:  p.flagSet,
+		out:      p.out,
+		outErr:   p.outErr,
+	}
+	for _, r := range p.reporters() {
+		if err := r.Report(final, run); err != nil {
+			return err
+		}
+	}
+	if p.shard != "" {
+		if err := writeTimings(p.shardSpec.filename("timings.json"), p.timings); err != nil {
+			return err
+		}
 	}
+	if len(entries) > 1 {
+		reportMatrix(p.out, entries, profs)
+	}
+	p.reportUntested()
 	return nil
 }
 
+func writeProfileFile(filename string, prof *profile) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	if err := prof.write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing to: %s, %s", filename, err)
+	}
+	return f.Close()
+}
+
+// reportUntested lists the packages that were included with zero coverage
+// because they have Go files but no test files
+func (p *Program) reportUntested() {
+	if len(p.untested) == 0 {
+		return
+	}
+	fmt.Fprintln(p.out, "Untested packages included with zero coverage:")
+	for _, rel := range p.untested {
+		fmt.Fprintf(p.out, "  %s\n", rel)
+	}
+}
+
 func (p *Program) makeWalker(
 	wd string,
-	buff *bytes.Buffer,
+	buffs []bytes.Buffer,
 ) func(string, os.FileInfo, error) error {
 	return func(path string, info os.FileInfo, err error) error {
 		if !info.IsDir() {
@@ -236,21 +787,135 @@ func (p *Program) makeWalker(
 			return filepath.SkipDir
 		}
 
-		files, err := filepath.Glob(filepath.Join(path, "*_test.go"))
+		status, err := p.dirStatus(path)
 		if err != nil {
-			return fmt.Errorf("error checking for test files")
+			return err
 		}
-		if len(files) == 0 {
+		switch status {
+		case dirNoTests:
 			if p.verbose {
 				fmt.Fprintf(p.out, "No Go test files in dir: %s, skipping\n", rel)
 			}
 			return nil
+		case dirUntested:
+			if p.verbose {
+				fmt.Fprintf(p.out,
+					"No Go test files in dir: %s, including as untested\n", rel)
+			}
+		}
+		if p.shardOf != nil && p.shardOf[filepath.ToSlash(rel)] != p.shardSpec.index {
+			if p.verbose {
+				fmt.Fprintf(p.out, "Skipping dir: %s, not in shard %s\n",
+					rel, p.shardSpec)
+			}
+			return nil
 		}
-		return p.processDir(wd, path, buff)
+		return p.processMatrix(wd, path, buffs)
 	}
 }
 
-func (p *Program) processDir(wd string, path string, buff *bytes.Buffer) error {
+// dirStatus describes whether the tests should be run in a directory
+type dirStatus int
+
+const (
+	dirTested dirStatus = iota
+	dirUntested
+	dirNoTests
+)
+
+// dirStatus returns whether the tests should be run in the directory path
+func (p *Program) dirStatus(path string) (dirStatus, error) {
+	files, err := filepath.Glob(filepath.Join(path, "*_test.go"))
+	if err != nil {
+		return dirNoTests, fmt.Errorf("error checking for test files")
+	}
+	if len(files) > 0 {
+		return dirTested, nil
+	}
+	if p.includeUntested {
+		hasGo, err := hasGoFiles(path)
+		if err != nil {
+			return dirNoTests, err
+		}
+		if hasGo {
+			return dirUntested, nil
+		}
+	}
+	return dirNoTests, nil
+}
+
+// discoverPackages returns the directories, relative to wd and using
+// forward slashes, whose tests would be run
+func (p *Program) discoverPackages(wd string) ([]string, error) {
+	pkgs := []string{}
+	err := filepath.Walk(wd, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(wd, path)
+		if err != nil {
+			return fmt.Errorf("error creating relative path")
+		}
+		if p.ignoreDir(rel) {
+			return filepath.SkipDir
+		}
+		status, err := p.dirStatus(path)
+		if err != nil {
+			return err
+		}
+		if status != dirNoTests {
+			pkgs = append(pkgs, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return pkgs, err
+}
+
+// processMatrix runs the coverage tests for the package in path under
+// each matrix entry, writing the profile for each entry to its buffer
+func (p *Program) processMatrix(
+	wd string,
+	path string,
+	buffs []bytes.Buffer,
+) error {
+	start := time.Now()
+	for i, entry := range p.matrixEntries() {
+		if err := p.processDir(wd, path, entry, &buffs[i]); err != nil {
+			return err
+		}
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil {
+		return fmt.Errorf("can't create relative path")
+	}
+	p.timings[filepath.ToSlash(rel)] = time.Since(start).Seconds()
+	return nil
+}
+
+// hasGoFiles returns true if dir contains any Go source files
+func hasGoFiles(dir string) (bool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return false, fmt.Errorf("error checking for Go files")
+	}
+	return len(files) > 0, nil
+}
+
+// processDir runs the coverage tests for the package in path.  For a package
+// without test files go test still outputs a profile in which every
+// statement has a zero count, which is how untested packages are included,
+// and for versions of Go that don't, one is made by untestedProfile.
+// Packages that go test reports as having nothing to test are skipped,
+// only real failures are returned as an error.
+func (p *Program) processDir(
+	wd string,
+	path string,
+	entry matrixEntry,
+	buff *bytes.Buffer,
+) error {
 	var cmd *exec.Cmd
 	var cmdOut bytes.Buffer
 	var cmdErr bytes.Buffer
@@ -260,63 +925,230 @@ func (p *Program) processDir(wd string, path string, buff *bytes.Buffer) error {
 	}
 	defer os.Chdir(wd)
 
-	outDir, err := ioutil.TempDir("", "roveralls")
+	rel, err := filepath.Rel(wd, path)
 	if err != nil {
-		return err
+		return fmt.Errorf("can't create relative path")
 	}
-	defer os.RemoveAll(outDir)
 
-	if p.verbose {
-		rel, err := filepath.Rel(wd, path)
+	var outDir string
+	if p.outDir == "" {
+		outDir, err = ioutil.TempDir("", "roveralls")
 		if err != nil {
-			return fmt.Errorf("can't create relative path")
+			return err
 		}
-		fmt.Fprintf(p.out, "Processing dir: %s\n", rel)
-		if p.short {
-			fmt.Fprintf(p.out,
-				"Processing: go test -short -covermode=%s -coverprofile=profile.coverprofile -outputdir=%s\n",
-				p.cover, outDir)
-		} else {
-			fmt.Fprintf(p.out,
-				"Processing: go test -covermode=%s -coverprofile=profile.coverprofile -outputdir=%s\n",
-				p.cover, outDir)
+		defer os.RemoveAll(outDir)
+	} else {
+		outDir = p.packageOutDir(rel, entry)
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return err
 		}
 	}
+	args := p.goTestArgs(outDir, entry)
+	env := entry.environ()
+	if p.verbose {
+		fmt.Fprintf(p.out, "Processing dir: %s\n", rel)
+		cmdLine := append(append([]string{}, env...), "go")
+		cmdLine = append(cmdLine, args...)
+		fmt.Fprintf(p.out, "Processing: %s\n", strings.Join(cmdLine, " "))
+	}
 
-	if p.short {
-		cmd = exec.Command("go",
-			"test",
-			"-short",
-			"-covermode="+p.cover,
-			"-coverprofile=profile.coverprofile",
-			"-outputdir="+outDir,
-		)
-	} else {
-		cmd = exec.Command("go",
-			"test",
-			"-covermode="+p.cover,
-			"-coverprofile=profile.coverprofile",
-			"-outputdir="+outDir,
-		)
+	cmd = exec.Command("go", args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
 	}
 	cmd.Stdout = &cmdOut
 	cmd.Stderr = &cmdErr
-	if err := cmd.Run(); err != nil {
-		return goTestError{
-			stderr: cmdErr.String(),
-			stdout: cmdOut.String(),
+	start := time.Now()
+	runErr := cmd.Run()
+	duration := time.Since(start)
+	events, textOut := parseTestEvents(cmdOut.Bytes())
+	outcome := classifyGoTest(runErr, events, cmdErr.String())
+	if p.outDir != "" {
+		err := p.keepOutput(outDirResult{
+			pkg:      eventsPackage(events),
+			rel:      rel,
+			entry:    entry,
+			dir:      outDir,
+			stdout:   cmdOut.Bytes(),
+			stderr:   cmdErr.Bytes(),
+			runErr:   runErr,
+			outcome:  outcome,
+			duration: duration,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !outcome.isSkip() {
+		if len(p.matrix) > 0 {
+			for i := range events {
+				events[i].Matrix = entry.String()
+			}
 		}
+		p.testEvents = append(p.testEvents, events...)
+	}
+	if outcome == testsFailed {
+		return p.makeGoTestError(rel, events, textOut, cmdErr.String())
+	}
+	isUntested := outcome == noTestFiles && p.includeUntested
+	if outcome.isSkip() && !isUntested {
+		if p.verbose {
+			fmt.Fprintf(p.out, "Skipping dir: %s, %s\n", rel, outcome)
+		}
+		return nil
 	}
 
 	b, err := ioutil.ReadFile(filepath.Join(outDir, "profile.coverprofile"))
 	if err != nil {
-		return err
+		if !isUntested || !os.IsNotExist(err) {
+			return err
+		}
+		// Versions of Go before 1.22 don't output a profile for packages
+		// without test files, so the tests are run again with an empty one
+		b, err = p.untestedProfile(path, rel, entry)
+		if err != nil {
+			return err
+		}
+	}
+	if isUntested && !p.isUntested(rel) {
+		p.untested = append(p.untested, rel)
 	}
 
 	_, err = buff.Write(b)
 	return err
 }
 
+// untestedFilename is the name of the empty test file that is added to
+// packages without test files so that go test outputs a profile for them
+const untestedFilename = "roveralls_untested_test.go"
+
+// untestedProfile returns the profile for the package in path, which has
+// no test files, by running go test with an empty test file added to the
+// package through an overlay, so that the package's dir isn't changed
+func (p *Program) untestedProfile(
+	path string,
+	rel string,
+	entry matrixEntry,
+) ([]byte, error) {
+	ctx := build.Default
+	if entry.tags != "" {
+		ctx.BuildTags = strings.Split(entry.tags, ",")
+	}
+	if entry.goarch != "" {
+		ctx.GOARCH = entry.goarch
+	}
+	pkg, err := ctx.ImportDir(path, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't find package in: %s, %s", rel, err)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "roveralls")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	testFilename := filepath.Join(tmpDir, untestedFilename)
+	testSrc := fmt.Sprintf("package %s\n", pkg.Name)
+	if err := ioutil.WriteFile(testFilename, []byte(testSrc), 0644); err != nil {
+		return nil, err
+	}
+	overlay, err := json.Marshal(struct{ Replace map[string]string }{
+		map[string]string{filepath.Join(path, untestedFilename): testFilename},
+	})
+	if err != nil {
+		return nil, err
+	}
+	overlayFilename := filepath.Join(tmpDir, "overlay.json")
+	if err := ioutil.WriteFile(overlayFilename, overlay, 0644); err != nil {
+		return nil, err
+	}
+
+	args := append(p.goTestArgs(tmpDir, entry), "-overlay="+overlayFilename)
+	env := entry.environ()
+	if p.verbose {
+		cmdLine := append(append([]string{}, env...), "go")
+		cmdLine = append(cmdLine, args...)
+		fmt.Fprintf(p.out, "Processing: %s\n", strings.Join(cmdLine, " "))
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = path
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var cmdErr bytes.Buffer
+	cmd.Stderr = &cmdErr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("can't get coverage of untested package in: %s, %s",
+			rel, strings.TrimSpace(cmdErr.String()))
+	}
+	return ioutil.ReadFile(filepath.Join(tmpDir, "profile.coverprofile"))
+}
+
+// isUntested returns true if the package in dir rel has already been
+// included as untested
+func (p *Program) isUntested(rel string) bool {
+	for _, r := range p.untested {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// goTestArgs returns the arguments to pass to go to run the coverage tests
+func (p *Program) goTestArgs(outDir string, entry matrixEntry) []string {
+	args := []string{"test", "-json"}
+	if p.short {
+		args = append(args, "-short")
+	}
+	if entry.tags != "" {
+		args = append(args, "-tags="+entry.tags)
+	}
+	return append(args,
+		"-covermode="+p.cover,
+		"-coverprofile=profile.coverprofile",
+		"-outputdir="+outDir,
+	)
+}
+
+// makeGoTestError creates a goTestError for a failed go test run on the
+// package in dir rel, writing the full log to p.failureLogs if set
+func (p *Program) makeGoTestError(
+	rel string,
+	events []testEvent,
+	stdout string,
+	stderr string,
+) error {
+	gerr := goTestError{
+		pkg:      eventsPackage(events),
+		failures: findTestFailures(events),
+		stderr:   stderr,
+		stdout:   stdout,
+	}
+	if p.failureLogs == "" {
+		return gerr
+	}
+	if err := os.MkdirAll(p.failureLogs, 0755); err != nil {
+		return err
+	}
+	gerr.logFile = filepath.Join(p.failureLogs, logFilename(rel))
+	if err := ioutil.WriteFile(gerr.logFile, []byte(stdout+stderr), 0644); err != nil {
+		return fmt.Errorf("error writing to: %s, %s", gerr.logFile, err)
+	}
+	return gerr
+}
+
+// logFilename returns a flat filename for the log of the package in dir
+// rel.  The '/'s in rel are percent-encoded, along with '%' itself, so
+// that different directories can't share a filename.
+func logFilename(rel string) string {
+	if rel == "." {
+		return "%2E.log"
+	}
+	return strings.NewReplacer("%", "%25", "/", "%2F").
+		Replace(filepath.ToSlash(rel)) + ".log"
+}
+
 func main() {
 	initProgram(os.Args, os.Stdout, os.Stderr, os.Getenv("GOPATH"))
 	os.Exit(program.Run())
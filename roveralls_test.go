@@ -5,9 +5,11 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"syscall"
 	"testing"
@@ -38,14 +40,23 @@ func TestRun(t *testing.T) {
 				"^GOPATH: .*$",
 				"^Working dir: .*$",
 				"^No Go test files in dir: ., skipping$",
+				"^Processing dir: build-excluded$",
+				"^Processing: go test -json -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Skipping dir: build-excluded, build constraints exclude all Go files$",
 				"^Processing dir: good$",
-				"^Processing: go test -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Processing: go test -json -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
 				"^Processing dir: good2$",
-				"^Processing: go test -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Processing: go test -json -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
 				"^No Go test files in dir: no-go-files, skipping$",
+				"^Processing dir: no-statements$",
+				"^Processing: go test -json -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Skipping dir: no-statements, no statements$",
 				"^No Go test files in dir: no-test-files, skipping$",
 				"^Processing dir: short$",
-				"^Processing: go test -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Processing: go test -json -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Processing dir: tests-excluded$",
+				"^Processing: go test -json -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Skipping dir: tests-excluded, no test files$",
 			},
 			wantFiles: []string{
 				filepath.Join("fixtures", "good", "good.go"),
@@ -79,12 +90,21 @@ func TestRun(t *testing.T) {
 				"^GOPATH: .*$",
 				"^Working dir: .*$",
 				"^No Go test files in dir: ., skipping$",
+				"^Processing dir: build-excluded$",
+				"^Processing: go test -json -short -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Skipping dir: build-excluded, build constraints exclude all Go files$",
 				"^Processing dir: good$",
-				"^Processing: go test -short -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Processing: go test -json -short -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
 				"^No Go test files in dir: no-go-files, skipping$",
+				"^Processing dir: no-statements$",
+				"^Processing: go test -json -short -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Skipping dir: no-statements, no statements$",
 				"^No Go test files in dir: no-test-files, skipping$",
 				"^Processing dir: short$",
-				"^Processing: go test -short -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Processing: go test -json -short -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Processing dir: tests-excluded$",
+				"^Processing: go test -json -short -covermode=count -coverprofile=profile.coverprofile -outputdir=.*$",
+				"^Skipping dir: tests-excluded, no test files$",
 			},
 			wantFiles: []string{
 				filepath.Join("fixtures", "good", "good.go"),
@@ -158,6 +178,47 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestRun_deterministic(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir("fixtures"); err != nil {
+		t.Fatalf("ChDir(fixtures) err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	profiles := make([]string, 2)
+	for i := range profiles {
+		var gotOut bytes.Buffer
+		var gotErr bytes.Buffer
+		cmdArgs := []string{os.Args[0], "-include-untested", "-drop-empty"}
+		initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+		if exitCode := program.Run(); exitCode != 0 {
+			t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+				exitCode, gotErr.String())
+		}
+		b, err := ioutil.ReadFile(outFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		profiles[i] = string(b)
+	}
+	if profiles[0] != profiles[1] {
+		t.Errorf("profiles differ between runs, got: %s, then: %s",
+			profiles[0], profiles[1])
+	}
+	prof, err := parseProfile(strings.NewReader(profiles[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sort.SliceIsSorted(prof.blocks, func(i, j int) bool {
+		return prof.blocks[i].file < prof.blocks[j].file
+	}) {
+		t.Errorf("profile not sorted by file: %s", profiles[0])
+	}
+}
+
 func TestRun_errors(t *testing.T) {
 	initProgram(os.Args, os.Stdout, os.Stderr, os.Getenv("GOPATH"))
 	cases := []struct {
@@ -175,6 +236,34 @@ func TestRun_errors(t *testing.T) {
 			wantOut:      "",
 			wantErr:      "invalid covermode 'nothing'\n" + usageMsg(),
 		},
+		{dir: "fixtures",
+			cmdArgs:      []string{os.Args[0], "-path-style=bob"},
+			gopath:       os.Getenv("GOPATH"),
+			wantExitCode: 1,
+			wantOut:      "",
+			wantErr:      "invalid path-style 'bob'\n" + usageMsg(),
+		},
+		{dir: "fixtures",
+			cmdArgs:      []string{os.Args[0], "-func-sort=bob"},
+			gopath:       os.Getenv("GOPATH"),
+			wantExitCode: 1,
+			wantOut:      "",
+			wantErr:      "invalid func-sort 'bob'\n" + usageMsg(),
+		},
+		{dir: "fixtures",
+			cmdArgs:      []string{os.Args[0], "-func-format=bob"},
+			gopath:       os.Getenv("GOPATH"),
+			wantExitCode: 1,
+			wantOut:      "",
+			wantErr:      "invalid func-format 'bob'\n" + usageMsg(),
+		},
+		{dir: "fixtures",
+			cmdArgs:      []string{os.Args[0], "-list-uncovered-glob=[a"},
+			gopath:       os.Getenv("GOPATH"),
+			wantExitCode: 1,
+			wantOut:      "",
+			wantErr:      "invalid list-uncovered-glob '[a'\n" + usageMsg(),
+		},
 		{dir: "fixtures",
 			cmdArgs:      []string{os.Args[0], "-bob"},
 			gopath:       os.Getenv("GOPATH"),
@@ -228,6 +317,70 @@ func TestRun_errors(t *testing.T) {
 	}
 }
 
+func TestRun_includeUntested(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{os.Args[0], "-covermode=count", "-include-untested"}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir("fixtures"); err != nil {
+		t.Fatalf("ChDir(fixtures) err: %s", err)
+	}
+	os.Remove(filepath.Join("roveralls.coverprofile"))
+	defer os.Remove(filepath.Join("roveralls.coverprofile"))
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Errorf("Run: incorrect exit code, got: %d, want: 0", exitCode)
+	}
+	if gotErr.String() != "" {
+		t.Errorf("Run: gotErr: %s", gotErr.String())
+	}
+	wantOutRegexps := []string{
+		"^Untested packages included with zero coverage:$",
+		"^  no-test-files$",
+		"^  tests-excluded$",
+	}
+	if err := checkOutput(wantOutRegexps, gotOut.String()); err != nil {
+		t.Errorf("checkOutput: %s", err)
+	}
+	b, err := ioutil.ReadFile("roveralls.coverprofile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLine := regexp.MustCompile("(?m)/no-test-files/notestfiles.go:.* 0$")
+	if !wantLine.Match(b) {
+		t.Errorf("no zero cover entries for notestfiles.go in: %s", b)
+	}
+}
+
+func TestUntestedProfile(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pOut bytes.Buffer
+	program := &Program{cover: "count", out: &pOut}
+	cases := []string{"no-test-files", "tests-excluded"}
+	for _, dir := range cases {
+		path := filepath.Join(wd, "fixtures", dir)
+		got, err := program.untestedProfile(path, dir, matrixEntry{})
+		if err != nil {
+			t.Errorf("untestedProfile(%s) err: %s", dir, err)
+			continue
+		}
+		wantLine := regexp.MustCompile("(?m)/" + dir + "/[^/]+.go:.* 0$")
+		if !wantLine.Match(got) {
+			t.Errorf("untestedProfile(%s) no zero cover entries in: %s", dir, got)
+		}
+		if _, err := os.Stat(filepath.Join(path, untestedFilename)); err == nil {
+			t.Errorf("untestedProfile(%s) test file written to package dir", dir)
+		}
+	}
+}
+
 func TestProcessDir_errors(t *testing.T) {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -263,11 +416,139 @@ func TestProcessDir_errors(t *testing.T) {
 		var gotOut bytes.Buffer
 		var pOut bytes.Buffer
 		program := &Program{cover: c.cover, out: &pOut, verbose: true}
-		err := program.processDir(wd, c.path, &gotOut)
+		err := program.processDir(wd, c.path, matrixEntry{}, &gotOut)
 		checkErrorMatch(t, fmt.Sprintf("(%d) processDir: ", i), err, c.wantErr)
 	}
 }
 
+func TestProcessDir_failing(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	logDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(logDir)
+
+	var gotOut bytes.Buffer
+	var pOut bytes.Buffer
+	program := &Program{cover: "count", out: &pOut, failureLogs: logDir}
+	path := filepath.Join(wd, "testdata", "failing")
+	err = program.processDir(wd, path, matrixEntry{}, &gotOut)
+	gerr, ok := err.(goTestError)
+	if !ok {
+		t.Fatalf("processDir: got err: %v, want goTestError", err)
+	}
+	wantTests := []string{"TestAmIGood", "TestPanic"}
+	if len(gerr.failures) != len(wantTests) {
+		t.Fatalf("processDir: got failures: %v, want tests: %v",
+			gerr.failures, wantTests)
+	}
+	for i, f := range gerr.failures {
+		if f.test != wantTests[i] {
+			t.Errorf("processDir: got failure: %s, want: %s", f.test, wantTests[i])
+		}
+	}
+	if gerr.failures[0].location != "failing_test.go:9" {
+		t.Errorf("processDir: got location: %s, want: failing_test.go:9",
+			gerr.failures[0].location)
+	}
+	if !gerr.failures[1].panicked {
+		t.Errorf("processDir: TestPanic not marked as panicked")
+	}
+	wantLogFile := filepath.Join(logDir, "testdata%2Ffailing.log")
+	if gerr.logFile != wantLogFile {
+		t.Errorf("processDir: got logFile: %s, want: %s", gerr.logFile, wantLogFile)
+	}
+	if _, err := os.Stat(wantLogFile); err != nil {
+		t.Errorf("processDir: log file not written: %s", err)
+	}
+}
+
+func TestProcessDir_testLogsCoverage(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	var gotOut bytes.Buffer
+	var pOut bytes.Buffer
+	program := &Program{cover: "count", out: &pOut, verbose: true}
+	path := filepath.Join(wd, "testdata", "logscoverage")
+	if err := program.processDir(wd, path, matrixEntry{}, &gotOut); err != nil {
+		t.Fatalf("processDir err: %s", err)
+	}
+	if !strings.Contains(gotOut.String(), "/logscoverage.go:") {
+		t.Errorf("processDir: coverage not included, got: %s, out: %s",
+			gotOut.String(), pOut.String())
+	}
+}
+
+func TestIgnoreDir(t *testing.T) {
+	program := &Program{ignores: map[string]bool{".git": true, "vendor": true}}
+	cases := []struct {
+		dir  string
+		want bool
+	}{
+		{dir: ".", want: false},
+		{dir: "fixtures", want: false},
+		{dir: "vendor", want: true},
+		{dir: "testdata", want: true},
+		{dir: filepath.Join("a", "testdata"), want: true},
+		{dir: filepath.Join("a", "testdata2"), want: false},
+	}
+	for _, c := range cases {
+		got := program.ignoreDir(c.dir)
+		if got != c.want {
+			t.Errorf("ignoreDir(%s) got: %t, want: %t", c.dir, got, c.want)
+		}
+	}
+}
+
+func TestLogFilename(t *testing.T) {
+	cases := []struct {
+		rel  string
+		want string
+	}{
+		{rel: ".", want: "%2E.log"},
+		{rel: "a", want: "a.log"},
+		{rel: filepath.Join("a", "b"), want: "a%2Fb.log"},
+		{rel: "a_b", want: "a_b.log"},
+		{rel: "a%2Fb", want: "a%252Fb.log"},
+	}
+	for _, c := range cases {
+		got := logFilename(c.rel)
+		if got != c.want {
+			t.Errorf("logFilename(%s) got: %s, want: %s", c.rel, got, c.want)
+		}
+	}
+}
+
+func TestHandleFlags_failureLogs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{os.Args[0], "-failure-logs", "logs"}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := program.flagSet.Parse(cmdArgs[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if isProblem := program.handleFlags(); isProblem {
+		t.Fatalf("handleFlags: gotErr: %s", gotErr.String())
+	}
+	want := filepath.Join(wd, "logs")
+	if program.failureLogs != want {
+		t.Errorf("handleFlags: got failureLogs: %s, want: %s",
+			program.failureLogs, want)
+	}
+}
+
 func TestUsage(t *testing.T) {
 	var gotErr bytes.Buffer
 	initProgram(os.Args, os.Stdout, &gotErr, os.Getenv("GOPATH"))
@@ -290,6 +571,39 @@ func TestGoTestErrorError(t *testing.T) {
 	}
 }
 
+func TestGoTestErrorError_failures(t *testing.T) {
+	err := goTestError{
+		pkg: "example.com/failing",
+		failures: []testFailure{
+			{test: "TestAmIGood",
+				output:   []string{"    failing_test.go:9: AmIGood() got: false, want: true"},
+				location: "failing_test.go:9",
+			},
+			{test: "TestPanic",
+				output: []string{
+					"panic: assignment to entry in nil map",
+					"goroutine 8 [running]:",
+				},
+				location: "/src/failing/failing_test.go:18",
+				panicked: true,
+			},
+		},
+		logFile: "logs/failing.log",
+		stderr:  "",
+		stdout:  "lots of output",
+	}
+	want := "error from go test for package: example.com/failing\n" +
+		"--- FAIL: TestAmIGood at failing_test.go:9\n" +
+		"    failing_test.go:9: AmIGood() got: false, want: true\n" +
+		"--- PANIC: TestPanic at /src/failing/failing_test.go:18\n" +
+		"    panic: assignment to entry in nil map\n" +
+		"full log: logs/failing.log"
+	got := err.Error()
+	if got != want {
+		t.Errorf("Error() got: %s, want: %s", got, want)
+	}
+}
+
 func TestWalkingErrorError(t *testing.T) {
 	err := walkingError{
 		err: errors.New("this is an error"),
@@ -309,7 +623,8 @@ func TestWalkingErrorError(t *testing.T) {
 var fileTestedRegexp = regexp.MustCompile("^(.*?)(:\\d.*) (\\d+)$")
 
 func makeUsageMsgRegexps() []string {
-	lines := strings.Split(usageMsg(), "\n")[:15]
+	lines := strings.Split(usageMsg(), "\n")
+	lines = lines[:len(lines)-1]
 	r := make([]string, len(lines))
 	for i, l := range lines {
 		r[i] = regexp.QuoteMeta(l)
@@ -0,0 +1,266 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifBaseID  = "%SRCROOT%"
+)
+
+var validSarifBys = map[string]bool{"block": true, "func": true}
+
+// sarifRules are the rules that results can be for
+var sarifRules = map[string]sarifRule{
+	"block": {
+		ID:               "uncovered-block",
+		ShortDescription: sarifMessage{Text: "Block not covered by tests"},
+		DefaultConfig:    sarifRuleConfig{Level: "warning"},
+	},
+	"func": {
+		ID:               "uncovered-function",
+		ShortDescription: sarifMessage{Text: "Function not covered by tests"},
+		DefaultConfig:    sarifRuleConfig{Level: "warning"},
+	},
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                   `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLoc `json:"originalUriBaseIds"`
+	ColumnKind         string                      `json:"columnKind"`
+	Results            []sarifResult               `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string          `json:"id"`
+	ShortDescription sarifMessage    `json:"shortDescription"`
+	DefaultConfig    sarifRuleConfig `json:"defaultConfiguration"`
+}
+
+type sarifRuleConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLoc `json:"physicalLocation"`
+}
+
+type sarifPhysicalLoc struct {
+	ArtifactLocation sarifArtifactLoc `json:"artifactLocation"`
+	Region           sarifRegion      `json:"region"`
+}
+
+type sarifArtifactLoc struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// sarifReporter writes a SARIF log with a result for each uncovered block,
+// or each uncovered function if by is "func".  If base isn't empty only
+// the files changed since the git ref base are included.
+type sarifReporter struct {
+	filename string
+	by       string
+	base     string
+}
+
+// makeSarif returns a SARIF log with a result for each uncovered block or
+// function in prof, with the paths of the files relative to baseDir.  If
+// changed isn't nil only the files in it are included.  Warnings about
+// files whose functions can't be found are written to warn.
+func makeSarif(
+	prof *profile,
+	resolver *pathResolver,
+	baseDir string,
+	changed changedLines,
+	by string,
+	warn io.Writer,
+) (sarifLog, error) {
+	rule := sarifRules[by]
+	results := []sarifResult{}
+	summary := summarize(prof)
+	var funcs []funcCoverage
+	if by == "func" {
+		funcs = funcCoverages(summary, resolver, warn)
+	}
+	for _, f := range summary.files {
+		path, err := resolver.relPath(baseDir, f.file)
+		if err != nil {
+			return sarifLog{}, err
+		}
+		if _, ok := changed[path]; changed != nil && !ok {
+			continue
+		}
+		// The columns are only given if the source can be read to convert
+		// them from bytes to code points
+		lines, err := readSourceLines(resolver, f.file)
+		if err != nil {
+			lines = nil
+		}
+		result := func(msg string, region sarifRegion) sarifResult {
+			return sarifResult{
+				RuleID:  rule.ID,
+				Level:   rule.DefaultConfig.Level,
+				Message: sarifMessage{Text: msg},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLoc{
+					ArtifactLocation: sarifArtifactLoc{URI: path, URIBaseID: sarifBaseID},
+					Region:           region,
+				}}},
+			}
+		}
+		if by == "func" {
+			for _, fc := range funcs {
+				if fc.File != f.file || fc.NumStmt == 0 || fc.Covered > 0 {
+					continue
+				}
+				fe := fc.extent
+				results = append(results, result(
+					fmt.Sprintf("Function %s not covered (%s)",
+						fc.Name, pluralStatements(fc.NumStmt)),
+					makeSarifRegion(lines, fe.startLine, fe.startCol, fe.endLine, fe.endCol),
+				))
+			}
+			continue
+		}
+		for _, b := range f.blocks {
+			if b.numStmt == 0 || b.count > 0 {
+				continue
+			}
+			results = append(results, result(
+				fmt.Sprintf("%s not covered", pluralStatements(b.numStmt)),
+				makeSarifRegion(lines, b.startLine, b.startCol, b.endLine, b.endCol),
+			))
+		}
+	}
+	return sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "roveralls",
+				InformationURI: "https://github.com/lawrencewoodman/roveralls",
+				Rules:          []sarifRule{rule},
+			}},
+			OriginalURIBaseIDs: map[string]sarifArtifactLoc{
+				sarifBaseID: {URI: fileURI(baseDir)},
+			},
+			ColumnKind: "unicodeCodePoints",
+			Results:    results,
+		}},
+	}, nil
+}
+
+// makeSarifRegion returns the region between the byte columns startCol
+// and endCol of the source lines, with the columns converted to code points
+func makeSarifRegion(
+	lines []string,
+	startLine, startCol, endLine, endCol int,
+) sarifRegion {
+	return sarifRegion{
+		StartLine:   startLine,
+		StartColumn: codePointColumn(lines, startLine, startCol),
+		EndLine:     endLine,
+		EndColumn:   codePointColumn(lines, endLine, endCol),
+	}
+}
+
+// codePointColumn converts col, a column of bytes starting at 1 on line,
+// to a column of Unicode code points.  It returns 0 if the position isn't
+// in lines.
+func codePointColumn(lines []string, line int, col int) int {
+	if line < 1 || line > len(lines) || col < 1 ||
+		col > len(lines[line-1])+1 {
+		return 0
+	}
+	return utf8.RuneCountInString(lines[line-1][:col-1]) + 1
+}
+
+// pluralStatements returns the number of statements n with a noun that
+// agrees with it
+func pluralStatements(n int) string {
+	if n == 1 {
+		return "1 statement"
+	}
+	return fmt.Sprintf("%d statements", n)
+}
+
+// fileURI returns the file URI of the directory dir
+func fileURI(dir string) string {
+	dir = filepath.ToSlash(dir)
+	if !strings.HasPrefix(dir, "/") {
+		dir = "/" + dir
+	}
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return "file://" + dir
+}
+
+func writeSarif(w io.Writer, log sarifLog) error {
+	b, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (r sarifReporter) Report(prof *profile, run *runInfo) error {
+	changed, baseDir, err := changedSince(run, r.base)
+	if err != nil {
+		return err
+	}
+	log, err := makeSarif(prof, run.resolver, baseDir, changed, r.by,
+		run.outErr)
+	if err != nil {
+		return err
+	}
+	return writeReportFile(r.filename, run.out, func(w io.Writer) error {
+		return writeSarif(w, log)
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// sarifResultSummary is the rule, message, uri and region of a result
+type sarifResultSummary struct {
+	ruleID  string
+	message string
+	uri     string
+	region  sarifRegion
+}
+
+func summarizeSarifResults(log sarifLog) []sarifResultSummary {
+	r := []sarifResultSummary{}
+	for _, result := range log.Runs[0].Results {
+		loc := result.Locations[0].PhysicalLocation
+		r = append(r, sarifResultSummary{
+			ruleID:  result.RuleID,
+			message: result.Message.Text,
+			uri:     loc.ArtifactLocation.URI,
+			region:  loc.Region,
+		})
+	}
+	return r
+}
+
+func TestMakeSarif(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "testdata/funcs/funcs.go"
+	prof := funcsProfile()
+	prof.blocks = append(prof.blocks,
+		profileBlock{file: file, startLine: 3, startCol: 1, endLine: 3, endCol: 5, numStmt: 0, count: 0})
+	cases := []struct {
+		by      string
+		changed changedLines
+		want    []sarifResultSummary
+	}{
+		{by: "block",
+			want: []sarifResultSummary{
+				{ruleID: "uncovered-block", message: "1 statement not covered",
+					uri: file, region: sarifRegion{9, 2, 9, 10}},
+				{ruleID: "uncovered-block", message: "1 statement not covered",
+					uri: file, region: sarifRegion{12, 24, 14, 2}},
+			}},
+		{by: "func",
+			want: []sarifResultSummary{
+				{ruleID: "uncovered-function",
+					message: "Function T.Value not covered (1 statement)",
+					uri:     file, region: sarifRegion{12, 1, 14, 2}},
+			}},
+		{by: "block", changed: changedLines{file: {}}, want: []sarifResultSummary{
+			{ruleID: "uncovered-block", message: "1 statement not covered",
+				uri: file, region: sarifRegion{9, 2, 9, 10}},
+			{ruleID: "uncovered-block", message: "1 statement not covered",
+				uri: file, region: sarifRegion{12, 24, 14, 2}},
+		}},
+		{by: "func", changed: changedLines{"other.go": {1: true}},
+			want: []sarifResultSummary{}},
+	}
+	for _, c := range cases {
+		log, err := makeSarif(prof, newPathResolver(), wd, c.changed, c.by,
+			ioutil.Discard)
+		if err != nil {
+			t.Fatalf("makeSarif err: %s", err)
+		}
+		if log.Version != "2.1.0" ||
+			log.Runs[0].Tool.Driver.Rules[0].ID != sarifRules[c.by].ID {
+			t.Errorf("makeSarif(%s) got: %v", c.by, log)
+		}
+		got := summarizeSarifResults(log)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("makeSarif(%s, %v) got: %v, want: %v",
+				c.by, c.changed, got, c.want)
+		}
+	}
+}
+
+func TestCodePointColumn(t *testing.T) {
+	lines := []string{"x := \"é\"; f()", "g()"}
+	cases := []struct {
+		line int
+		col  int
+		want int
+	}{
+		{line: 1, col: 1, want: 1},
+		{line: 1, col: 6, want: 6},
+		{line: 1, col: 11, want: 10},
+		{line: 1, col: 15, want: 14},
+		{line: 1, col: 16, want: 0},
+		{line: 2, col: 4, want: 4},
+		{line: 3, col: 1, want: 0},
+	}
+	for _, c := range cases {
+		got := codePointColumn(lines, c.line, c.col)
+		if got != c.want {
+			t.Errorf("codePointColumn(%d, %d) got: %d, want: %d",
+				c.line, c.col, got, c.want)
+		}
+	}
+	if got := codePointColumn(nil, 1, 1); got != 0 {
+		t.Errorf("codePointColumn(nil, 1, 1) got: %d, want: 0", got)
+	}
+}
+
+func TestWriteSarif(t *testing.T) {
+	log, err := makeSarif(funcsProfile(), newPathResolver(), "/src/proj",
+		nil, "block", ioutil.Discard)
+	if err != nil {
+		t.Fatalf("makeSarif err: %s", err)
+	}
+	var b bytes.Buffer
+	if err := writeSarif(&b, log); err != nil {
+		t.Fatalf("writeSarif err: %s", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("writeSarif invalid JSON: %s", err)
+	}
+	if got["$schema"] != sarifSchema || got["version"] != "2.1.0" {
+		t.Errorf("writeSarif got: %s", b.String())
+	}
+	run := got["runs"].([]interface{})[0].(map[string]interface{})
+	baseIDs := run["originalUriBaseIds"].(map[string]interface{})
+	srcRoot := baseIDs["%SRCROOT%"].(map[string]interface{})
+	if srcRoot["uri"] != "file:///src/proj/" {
+		t.Errorf("writeSarif got %%SRCROOT%%: %v, want: file:///src/proj/",
+			srcRoot["uri"])
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shardSpec describes which of count shards to run, index starts at 1
+type shardSpec struct {
+	index int
+	count int
+}
+
+// parseShard parses a shard of the form: i/n
+func parseShard(s string) (shardSpec, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return shardSpec{}, fmt.Errorf("invalid shard '%s'", s)
+	}
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return shardSpec{}, fmt.Errorf("invalid shard '%s'", s)
+	}
+	count, err := strconv.Atoi(parts[1])
+	if err != nil || index < 1 || count < 1 || index > count {
+		return shardSpec{}, fmt.Errorf("invalid shard '%s'", s)
+	}
+	return shardSpec{index: index, count: count}, nil
+}
+
+func (s shardSpec) String() string {
+	return fmt.Sprintf("%d/%d", s.index, s.count)
+}
+
+// filename returns the name of a file for this shard with ext
+func (s shardSpec) filename(ext string) string {
+	return fmt.Sprintf("roveralls.shard-%d-of-%d.%s", s.index, s.count, ext)
+}
+
+// assignShards deterministically assigns each package to a shard numbered
+// from 1.  Packages with a known duration are balanced across the shards
+// by giving the longest remaining package to the least loaded shard.
+// Packages without a known duration are assigned by a hash of their path.
+func assignShards(
+	pkgs []string,
+	timings map[string]float64,
+	count int,
+) map[string]int {
+	r := make(map[string]int, len(pkgs))
+	timed := []string{}
+	for _, pkg := range pkgs {
+		if _, ok := timings[pkg]; ok {
+			timed = append(timed, pkg)
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(pkg))
+		r[pkg] = int(h.Sum32()%uint32(count)) + 1
+	}
+
+	sort.Slice(timed, func(i, j int) bool {
+		ti, tj := timings[timed[i]], timings[timed[j]]
+		if ti != tj {
+			return ti > tj
+		}
+		return timed[i] < timed[j]
+	})
+	loads := make([]float64, count)
+	for _, pkg := range timed {
+		least := 0
+		for i, load := range loads {
+			if load < loads[least] {
+				least = i
+			}
+		}
+		loads[least] += timings[pkg]
+		r[pkg] = least + 1
+	}
+	return r
+}
+
+// readTimings reads and combines the package durations in filenames.
+// Files that don't exist are ignored so that the first run, before any
+// timings have been recorded, doesn't fail.
+func readTimings(filenames []string) (map[string]float64, error) {
+	timings := map[string]float64{}
+	for _, filename := range filenames {
+		b, err := ioutil.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		t := map[string]float64{}
+		if err := json.Unmarshal(b, &t); err != nil {
+			return nil, fmt.Errorf("error parsing timings: %s, %s", filename, err)
+		}
+		for pkg, d := range t {
+			timings[pkg] = d
+		}
+	}
+	return timings, nil
+}
+
+// writeTimings writes the duration in seconds of each package to filename
+func writeTimings(filename string, timings map[string]float64) error {
+	return writeJSONFile(filename, timings)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    shardSpec
+		wantErr bool
+	}{
+		{in: "1/3", want: shardSpec{index: 1, count: 3}},
+		{in: "3/3", want: shardSpec{index: 3, count: 3}},
+		{in: "0/3", wantErr: true},
+		{in: "4/3", wantErr: true},
+		{in: "1", wantErr: true},
+		{in: "a/b", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseShard(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseShard(%s) err: %v, wantErr: %t", c.in, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseShard(%s) got: %v, want: %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestAssignShards(t *testing.T) {
+	pkgs := []string{"a", "b", "c", "d", "e"}
+	timings := map[string]float64{"a": 10, "b": 6, "c": 5, "d": 1}
+	got := assignShards(pkgs, timings, 2)
+	want := map[string]int{"a": 1, "b": 2, "c": 2, "d": 1}
+	for pkg, shard := range want {
+		if got[pkg] != shard {
+			t.Errorf("assignShards: package: %s, got shard: %d, want: %d",
+				pkg, got[pkg], shard)
+		}
+	}
+	if got["e"] < 1 || got["e"] > 2 {
+		t.Errorf("assignShards: package: e, got shard: %d", got["e"])
+	}
+	if again := assignShards(pkgs, timings, 2); !reflect.DeepEqual(again, got) {
+		t.Errorf("assignShards not deterministic, got: %v, then: %v", got, again)
+	}
+}
+
+func TestReadTimings(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	a := filepath.Join(tmpDir, "a.json")
+	b := filepath.Join(tmpDir, "b.json")
+	if err := writeTimings(a, map[string]float64{"x": 1.5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTimings(b, map[string]float64{"y": 2}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readTimings([]string{a, b, filepath.Join(tmpDir, "missing.json")})
+	if err != nil {
+		t.Fatalf("readTimings: %s", err)
+	}
+	want := map[string]float64{"x": 1.5, "y": 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readTimings got: %v, want: %v", got, want)
+	}
+}
+
+func TestRun_shard(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir("fixtures"); err != nil {
+		t.Fatalf("ChDir(fixtures) err: %s", err)
+	}
+	gotFiles := map[string]bool{}
+	for _, shard := range []string{"1/2", "2/2"} {
+		var gotOut bytes.Buffer
+		var gotErr bytes.Buffer
+		cmdArgs := []string{os.Args[0], "-shard", shard}
+		initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+		if exitCode := program.Run(); exitCode != 0 {
+			t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+				exitCode, gotErr.String())
+		}
+		profileFilename := program.shardSpec.filename("coverprofile")
+		timingsFilename := program.shardSpec.filename("timings.json")
+		defer os.Remove(profileFilename)
+		defer os.Remove(timingsFilename)
+		files, err := filesTested(wd, profileFilename)
+		if err != nil {
+			t.Fatalf("filesTested err: %s", err)
+		}
+		for file := range files {
+			if gotFiles[file] {
+				t.Errorf("file: %s, tested by more than one shard", file)
+			}
+			gotFiles[file] = true
+		}
+		if _, err := readTimings([]string{timingsFilename}); err != nil {
+			t.Errorf("readTimings: %s", err)
+		}
+	}
+	wantFiles := map[string]bool{
+		filepath.Join("fixtures", "good", "good.go"):   true,
+		filepath.Join("fixtures", "good2", "good2.go"): true,
+	}
+	if !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Errorf("files tested by shards got: %v, want: %v", gotFiles, wantFiles)
+	}
+}
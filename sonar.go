@@ -0,0 +1,87 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type sonarCoverage struct {
+	XMLName xml.Name    `xml:"coverage"`
+	Version int         `xml:"version,attr"`
+	Files   []sonarFile `xml:"file"`
+}
+
+type sonarFile struct {
+	Path  string             `xml:"path,attr"`
+	Lines []sonarLineToCover `xml:"lineToCover"`
+}
+
+// sonarLineToCover is a line in SonarQube's generic coverage format.  A
+// line with more than one block is reported as having a branch per block.
+type sonarLineToCover struct {
+	LineNumber      int  `xml:"lineNumber,attr"`
+	Covered         bool `xml:"covered,attr"`
+	BranchesToCover int  `xml:"branchesToCover,attr,omitempty"`
+	CoveredBranches *int `xml:"coveredBranches,attr"`
+}
+
+// makeSonar converts prof into SonarQube's generic coverage format with
+// the paths of the files relative to baseDir
+func makeSonar(
+	prof *profile,
+	resolver *pathResolver,
+	baseDir string,
+) (sonarCoverage, error) {
+	r := sonarCoverage{Version: 1}
+	for _, f := range summarize(prof).files {
+		path, err := resolver.relPath(baseDir, f.file)
+		if err != nil {
+			return r, err
+		}
+		sf := sonarFile{Path: path}
+		lines := lineCoverage(f.blocks)
+		for _, line := range sortedLines(lines) {
+			lh := lines[line]
+			ltc := sonarLineToCover{LineNumber: line, Covered: lh.covered > 0}
+			if lh.blocks > 1 {
+				covered := lh.covered
+				ltc.BranchesToCover = lh.blocks
+				ltc.CoveredBranches = &covered
+			}
+			sf.Lines = append(sf.Lines, ltc)
+		}
+		r.Files = append(r.Files, sf)
+	}
+	return r, nil
+}
+
+func writeSonar(w io.Writer, sonar sonarCoverage) error {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(sonar); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeSonarFile writes prof to filename, or out if it is '-', in
+// SonarQube's generic coverage format
+func writeSonarFile(
+	filename string,
+	out io.Writer,
+	prof *profile,
+	resolver *pathResolver,
+	baseDir string,
+) error {
+	sonar, err := makeSonar(prof, resolver, baseDir)
+	if err != nil {
+		return err
+	}
+	return writeReportFile(filename, out, func(w io.Writer) error {
+		return writeSonar(w, sonar)
+	})
+}
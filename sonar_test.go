@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteSonar(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "testdata/funcs/funcs.go"
+	prof := &profile{mode: "set", blocks: []profileBlock{
+		{file: file, startLine: 5, startCol: 31, endLine: 6, endCol: 11, numStmt: 1, count: 1},
+		{file: file, startLine: 6, startCol: 11, endLine: 8, endCol: 3, numStmt: 1, count: 0},
+		{file: file, startLine: 12, startCol: 24, endLine: 14, endCol: 2, numStmt: 1, count: 0},
+	}}
+	sonar, err := makeSonar(prof, newPathResolver(), filepath.Join(wd, "testdata"))
+	if err != nil {
+		t.Fatalf("makeSonar err: %s", err)
+	}
+	var got bytes.Buffer
+	if err := writeSonar(&got, sonar); err != nil {
+		t.Fatalf("writeSonar err: %s", err)
+	}
+	want := `<coverage version="1">
+  <file path="funcs/funcs.go">
+    <lineToCover lineNumber="5" covered="true"></lineToCover>
+    <lineToCover lineNumber="6" covered="true" branchesToCover="2" coveredBranches="1"></lineToCover>
+    <lineToCover lineNumber="7" covered="false"></lineToCover>
+    <lineToCover lineNumber="8" covered="false"></lineToCover>
+    <lineToCover lineNumber="12" covered="false"></lineToCover>
+    <lineToCover lineNumber="13" covered="false"></lineToCover>
+    <lineToCover lineNumber="14" covered="false"></lineToCover>
+  </file>
+</coverage>
+`
+	if got.String() != want {
+		t.Errorf("writeSonar got: %s, want: %s", got.String(), want)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// summarySchemaVersion is increased whenever the layout of the JSON
+// summary changes in a way that would break its consumers
+const summarySchemaVersion = 1
+
+// jsonSummary is the JSON summary of a run
+type jsonSummary struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	Covermode     string               `json:"covermode"`
+	GoVersion     string               `json:"goVersion"`
+	GitCommit     string               `json:"gitCommit"`
+	Seconds       float64              `json:"seconds"`
+	Flags         map[string]string    `json:"flags"`
+	Total         jsonCoverage         `json:"total"`
+	Packages      []jsonPackageSummary `json:"packages"`
+}
+
+// jsonCoverage is the number of statements and how many were covered
+type jsonCoverage struct {
+	NumStmt int     `json:"statements"`
+	Covered int     `json:"covered"`
+	Percent float64 `json:"percent"`
+}
+
+// jsonPackageSummary is the coverage of a package in the JSON summary
+type jsonPackageSummary struct {
+	Package string `json:"package"`
+	jsonCoverage
+	Files []jsonFileSummary `json:"files"`
+}
+
+// jsonFileSummary is the coverage of a file in the JSON summary
+type jsonFileSummary struct {
+	File string `json:"file"`
+	jsonCoverage
+}
+
+func makeJSONCoverage(numStmt int, covered int) jsonCoverage {
+	return jsonCoverage{
+		NumStmt: numStmt,
+		Covered: covered,
+		Percent: percent(covered, numStmt),
+	}
+}
+
+// makeJSONSummary creates the JSON summary of a run that produced prof
+func makeJSONSummary(
+	prof *profile,
+	duration time.Duration,
+	fs *flag.FlagSet,
+) jsonSummary {
+	summary := summarize(prof)
+	s := jsonSummary{
+		SchemaVersion: summarySchemaVersion,
+		Covermode:     prof.mode,
+		GoVersion:     goVersion(),
+		GitCommit:     gitCommit(),
+		Seconds:       duration.Seconds(),
+		Flags:         setFlags(fs),
+		Total:         makeJSONCoverage(summary.numStmt, summary.covered),
+		Packages:      []jsonPackageSummary{},
+	}
+	for _, pc := range summary.packages {
+		ps := jsonPackageSummary{
+			Package:      pc.pkg,
+			jsonCoverage: makeJSONCoverage(pc.numStmt, pc.covered),
+			Files:        []jsonFileSummary{},
+		}
+		for _, f := range pc.files {
+			ps.Files = append(ps.Files, jsonFileSummary{
+				File:         f.file,
+				jsonCoverage: makeJSONCoverage(f.numStmt, f.covered),
+			})
+		}
+		s.Packages = append(s.Packages, ps)
+	}
+	return s
+}
+
+// setFlags returns the value of each flag that was set in fs
+func setFlags(fs *flag.FlagSet) map[string]string {
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	return flags
+}
+
+// goVersion returns the version of the go tool used to run the tests or
+// "" if it can't be found
+func goVersion() string {
+	return commandOutput("go", "env", "GOVERSION")
+}
+
+// gitCommit returns the hash of the commit checked out in the working
+// directory or "" if it isn't in a git repository
+func gitCommit() string {
+	return commandOutput("git", "rev-parse", "HEAD")
+}
+
+// commandOutput returns the trimmed stdout of a command or "" if it fails
+func commandOutput(name string, args ...string) string {
+	var cmdOut bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &cmdOut
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(cmdOut.String())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRun_jsonSummary(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	filename := filepath.Join(tmpDir, "summary.json")
+
+	var gotOut bytes.Buffer
+	var gotErr bytes.Buffer
+	cmdArgs := []string{
+		os.Args[0], "-covermode", "set", "-json-summary", filename,
+	}
+	initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+	if err := os.Chdir("fixtures"); err != nil {
+		t.Fatalf("ChDir(fixtures) err: %s", err)
+	}
+	defer os.Remove(outFilename)
+	if exitCode := program.Run(); exitCode != 0 {
+		t.Fatalf("Run: incorrect exit code, got: %d, want: 0, err: %s",
+			exitCode, gotErr.String())
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := jsonSummary{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SchemaVersion != summarySchemaVersion {
+		t.Errorf("schemaVersion got: %d, want: %d",
+			got.SchemaVersion, summarySchemaVersion)
+	}
+	if got.Covermode != "set" {
+		t.Errorf("covermode got: %s, want: set", got.Covermode)
+	}
+	if got.GoVersion == "" {
+		t.Errorf("goVersion got: \"\"")
+	}
+	wantFlags := map[string]string{"covermode": "set", "json-summary": filename}
+	if !reflect.DeepEqual(got.Flags, wantFlags) {
+		t.Errorf("flags got: %v, want: %v", got.Flags, wantFlags)
+	}
+	wantPackages := []string{
+		"github.com/lawrencewoodman/roveralls/fixtures/good",
+		"github.com/lawrencewoodman/roveralls/fixtures/good2",
+		"github.com/lawrencewoodman/roveralls/fixtures/short",
+	}
+	gotPackages := []string{}
+	numStmt := 0
+	for _, ps := range got.Packages {
+		gotPackages = append(gotPackages, ps.Package)
+		for _, f := range ps.Files {
+			numStmt += f.NumStmt
+		}
+	}
+	if !reflect.DeepEqual(gotPackages, wantPackages) {
+		t.Errorf("packages got: %v, want: %v", gotPackages, wantPackages)
+	}
+	if numStmt != got.Total.NumStmt || got.Total.NumStmt == 0 {
+		t.Errorf("statements in files: %d, total: %d", numStmt, got.Total.NumStmt)
+	}
+}
@@ -0,0 +1,6 @@
+package failing
+
+// AmIGood returns false so that its test fails
+func AmIGood() bool {
+	return false
+}
@@ -0,0 +1,19 @@
+package failing
+
+import (
+	"testing"
+)
+
+func TestAmIGood(t *testing.T) {
+	if !AmIGood() {
+		t.Error("AmIGood() got: false, want: true")
+	}
+}
+
+func TestPass(t *testing.T) {
+}
+
+func TestPanic(t *testing.T) {
+	var m map[string]int
+	m["a"] = 1
+}
@@ -0,0 +1,18 @@
+package funcs
+
+type T struct{}
+
+func (t *T) Method(n int) int {
+	if n > 0 {
+		return n
+	}
+	return 0
+}
+
+func (t T) Value() int {
+	return 1
+}
+
+func Plain() int {
+	return 2
+}
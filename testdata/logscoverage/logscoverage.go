@@ -0,0 +1,5 @@
+package logscoverage
+
+func F() int {
+	return 1
+}
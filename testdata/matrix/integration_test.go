@@ -0,0 +1,14 @@
+//go:build roverallsintegration
+// +build roverallsintegration
+
+package matrix
+
+import (
+	"testing"
+)
+
+func TestIntegration(t *testing.T) {
+	if !Integration() {
+		t.Error("Integration() got: false, want: true")
+	}
+}
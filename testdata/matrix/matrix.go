@@ -0,0 +1,11 @@
+package matrix
+
+// Plain returns true
+func Plain() bool {
+	return true
+}
+
+// Integration returns true
+func Integration() bool {
+	return true
+}
@@ -0,0 +1,11 @@
+package matrix
+
+import (
+	"testing"
+)
+
+func TestPlain(t *testing.T) {
+	if !Plain() {
+		t.Error("Plain() got: false, want: true")
+	}
+}
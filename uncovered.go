@@ -0,0 +1,98 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// uncoveredReporter lists each uncovered block in the style of compiler
+// errors, so that editors can jump to them.  Only blocks in the packages
+// matching pkgs, if set, the files matching glob, if set, and with at
+// least minStmts statements are listed.
+type uncoveredReporter struct {
+	filename string
+	pkgs     string
+	glob     string
+	minStmts int
+}
+
+// matchPackages returns true if pkg matches one of the comma separated
+// patterns, where a pattern ending in '/...' matches a package and those
+// below it
+func matchPackages(patterns string, pkg string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern == pkg {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/...") {
+			dir := strings.TrimSuffix(pattern, "/...")
+			if pkg == dir || strings.HasPrefix(pkg, dir+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchGlob returns true if the path of a file matches glob.  If glob
+// doesn't contain a '/' it is matched against the name of the file.
+func matchGlob(glob string, file string) (bool, error) {
+	if !strings.Contains(glob, "/") {
+		file = path.Base(file)
+	}
+	return path.Match(glob, file)
+}
+
+// writeUncovered writes a line for each uncovered block in prof that
+// passes the reporter's filters, with the paths of the files relative
+// to baseDir
+func (r uncoveredReporter) writeUncovered(
+	w io.Writer,
+	prof *profile,
+	resolver *pathResolver,
+	baseDir string,
+) error {
+	for _, f := range summarize(prof).files {
+		if r.pkgs != "" && !matchPackages(r.pkgs, f.pkg) {
+			continue
+		}
+		if f.covered == f.numStmt {
+			continue
+		}
+		filename, err := resolver.relPath(baseDir, f.file)
+		if err != nil {
+			return err
+		}
+		if r.glob != "" {
+			match, err := matchGlob(r.glob, filename)
+			if err != nil {
+				return fmt.Errorf("invalid glob: %s", r.glob)
+			}
+			if !match {
+				continue
+			}
+		}
+		for _, b := range f.blocks {
+			if b.count > 0 || b.numStmt == 0 || b.numStmt < r.minStmts {
+				continue
+			}
+			_, err := fmt.Fprintf(w, "%s:%d:%d: uncovered (%d statements)\n",
+				filename, b.startLine, b.startCol, b.numStmt)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r uncoveredReporter) Report(prof *profile, run *runInfo) error {
+	return writeReportFile(r.filename, run.out, func(w io.Writer) error {
+		return r.writeUncovered(w, prof, run.resolver, run.wd)
+	})
+}
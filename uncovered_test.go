@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestMatchPackages(t *testing.T) {
+	cases := []struct {
+		patterns string
+		pkg      string
+		want     bool
+	}{
+		{patterns: "a/b", pkg: "a/b", want: true},
+		{patterns: "a/b", pkg: "a/b/c", want: false},
+		{patterns: "a/b/...", pkg: "a/b", want: true},
+		{patterns: "a/b/...", pkg: "a/b/c", want: true},
+		{patterns: "a/b/...", pkg: "a/bc", want: false},
+		{patterns: "x,a/b/...", pkg: "a/b/c", want: true},
+		{patterns: "x,y", pkg: "a/b", want: false},
+	}
+	for _, c := range cases {
+		got := matchPackages(c.patterns, c.pkg)
+		if got != c.want {
+			t.Errorf("matchPackages(%s, %s) got: %t, want: %t",
+				c.patterns, c.pkg, got, c.want)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		glob string
+		file string
+		want bool
+	}{
+		{glob: "*.go", file: "a/b/c.go", want: true},
+		{glob: "c*.go", file: "a/b/c.go", want: true},
+		{glob: "a/*/c.go", file: "a/b/c.go", want: true},
+		{glob: "a/*.go", file: "a/b/c.go", want: false},
+		{glob: "d.go", file: "a/b/c.go", want: false},
+	}
+	for _, c := range cases {
+		got, err := matchGlob(c.glob, c.file)
+		if err != nil {
+			t.Fatalf("matchGlob(%s, %s) err: %s", c.glob, c.file, err)
+		}
+		if got != c.want {
+			t.Errorf("matchGlob(%s, %s) got: %t, want: %t",
+				c.glob, c.file, got, c.want)
+		}
+	}
+}
+
+func TestWriteUncovered(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "testdata/funcs/funcs.go"
+	prof := &profile{mode: "set", blocks: []profileBlock{
+		{file: file, startLine: 5, startCol: 31, endLine: 6, endCol: 11, numStmt: 1, count: 1},
+		{file: file, startLine: 6, startCol: 11, endLine: 8, endCol: 3, numStmt: 2, count: 0},
+		{file: file, startLine: 9, startCol: 2, endLine: 9, endCol: 10, numStmt: 1, count: 0},
+		{file: file, startLine: 12, startCol: 24, endLine: 14, endCol: 2, numStmt: 0, count: 0},
+	}}
+	cases := []struct {
+		reporter uncoveredReporter
+		want     string
+	}{
+		{reporter: uncoveredReporter{},
+			want: file + ":6:11: uncovered (2 statements)\n" +
+				file + ":9:2: uncovered (1 statements)\n"},
+		{reporter: uncoveredReporter{minStmts: 2},
+			want: file + ":6:11: uncovered (2 statements)\n"},
+		{reporter: uncoveredReporter{pkgs: "testdata/..."},
+			want: file + ":6:11: uncovered (2 statements)\n" +
+				file + ":9:2: uncovered (1 statements)\n"},
+		{reporter: uncoveredReporter{pkgs: "other"}, want: ""},
+		{reporter: uncoveredReporter{glob: "f*.go", minStmts: 2},
+			want: file + ":6:11: uncovered (2 statements)\n"},
+		{reporter: uncoveredReporter{glob: "*_test.go"}, want: ""},
+	}
+	for _, c := range cases {
+		var got bytes.Buffer
+		err := c.reporter.writeUncovered(&got, prof, newPathResolver(), wd)
+		if err != nil {
+			t.Fatalf("writeUncovered(%v) err: %s", c.reporter, err)
+		}
+		if got.String() != c.want {
+			t.Errorf("writeUncovered(%v) got: %s, want: %s",
+				c.reporter, got.String(), c.want)
+		}
+	}
+}
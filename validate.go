@@ -0,0 +1,300 @@
+// Copyright (c) 2016 Lawrence Woodman <lwoodman@vlifesystems.com>
+// Licensed under an MIT licence.  Please see LICENCE.md for details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// validationError is a problem found in a coverage profile
+type validationError struct {
+	line int
+	msg  string
+}
+
+// lineBlock is a block along with the line of the profile it came from
+type lineBlock struct {
+	line  int
+	block profileBlock
+}
+
+func (p *Program) validateUsageMsg(fs *flag.FlagSet) string {
+	var b bytes.Buffer
+	const desc = `
+roveralls validate checks that coverage profiles are well-formed and that
+the blocks in them fit within the source files that they refer to.
+`
+	fmt.Fprintf(&b, "%s\n", desc)
+	fmt.Fprintf(&b, "Usage: roveralls validate [-skip-source] profile ...\n")
+	fs.SetOutput(&b)
+	fs.PrintDefaults()
+	fs.SetOutput(p.outErr)
+	return b.String()
+}
+
+// runValidate runs the validate subcommand
+func (p *Program) runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(p.outErr)
+	fs.BoolVar(
+		&p.skipSource,
+		"skip-source",
+		false,
+		"Don't check the blocks against the source files",
+	)
+	fs.BoolVar(&p.help, "help", false, "Display this help")
+	fs.Usage = func() {
+		fmt.Fprint(p.outErr, p.validateUsageMsg(fs))
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if p.help {
+		fmt.Fprint(p.out, p.validateUsageMsg(fs))
+		return 0
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(p.outErr, "no profiles given to validate")
+		fmt.Fprint(p.outErr, p.validateUsageMsg(fs))
+		return 1
+	}
+
+	exitCode := 0
+	resolver := newPathResolver()
+	for _, filename := range fs.Args() {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(p.outErr, "%s\n", err)
+			exitCode = 1
+			continue
+		}
+		errs, err := validateProfile(f, resolver, !p.skipSource)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(p.outErr, "error reading: %s, %s\n", filename, err)
+			exitCode = 1
+			continue
+		}
+		for _, e := range errs {
+			fmt.Fprintf(p.outErr, "%s:%d: %s\n", filename, e.line, e.msg)
+		}
+		if len(errs) > 0 {
+			exitCode = 1
+			continue
+		}
+		fmt.Fprintf(p.out, "%s: valid\n", filename)
+	}
+	return exitCode
+}
+
+// validateProfile checks the profile read from r and returns any problems
+// found.  If checkSource is true the blocks are checked against the source
+// files found using resolver.
+func validateProfile(
+	r io.Reader,
+	resolver *pathResolver,
+	checkSource bool,
+) ([]validationError, error) {
+	errs := []validationError{}
+	addErr := func(line int, format string, a ...interface{}) {
+		errs = append(errs, validationError{line: line, msg: fmt.Sprintf(format, a...)})
+	}
+	blocks := []lineBlock{}
+	mode := ""
+	lineNum := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNum == 1 {
+			m, ok := parseMode(line)
+			switch {
+			case !ok:
+				addErr(lineNum, "missing mode line")
+			case m != "set" && m != "count" && m != "atomic":
+				addErr(lineNum, "invalid mode: %s", m)
+			default:
+				mode = m
+			}
+			if ok {
+				continue
+			}
+		}
+		if _, ok := parseMode(line); ok {
+			addErr(lineNum, "unexpected mode line")
+			continue
+		}
+		b, err := parseBlockLine(line)
+		if err != nil {
+			addErr(lineNum, "%s", err)
+			continue
+		}
+		if b.startLine < 1 || b.startCol < 1 || b.endLine < 1 || b.endCol < 1 {
+			addErr(lineNum, "invalid position in block: %s", b)
+			continue
+		}
+		if b.endLine < b.startLine ||
+			(b.endLine == b.startLine && b.endCol < b.startCol) {
+			addErr(lineNum, "block ends before it starts: %s", b)
+			continue
+		}
+		if mode == "set" && b.count > 1 {
+			addErr(lineNum, "count greater than 1 in set mode: %s", b)
+		}
+		blocks = append(blocks, lineBlock{line: lineNum, block: b})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if lineNum == 0 {
+		addErr(1, "empty profile")
+	}
+
+	errs = append(errs, checkBlockConsistency(blocks)...)
+	if checkSource {
+		errs = append(errs, checkBlockSources(blocks, resolver)...)
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].line < errs[j].line })
+	return errs, nil
+}
+
+// checkBlockConsistency reports duplicate blocks and blocks that overlap
+func checkBlockConsistency(blocks []lineBlock) []validationError {
+	errs := []validationError{}
+	seen := map[blockKey]lineBlock{}
+	byFile := map[string][]lineBlock{}
+	for _, lb := range blocks {
+		b := lb.block
+		if prev, ok := seen[b.key()]; ok {
+			if prev.block.numStmt != b.numStmt {
+				errs = append(errs, validationError{line: lb.line,
+					msg: fmt.Sprintf(
+						"inconsistent number of statements with duplicate block on line %d",
+						prev.line),
+				})
+			} else {
+				errs = append(errs, validationError{line: lb.line,
+					msg: fmt.Sprintf("duplicate of block on line %d", prev.line),
+				})
+			}
+			continue
+		}
+		seen[b.key()] = lb
+		byFile[b.file] = append(byFile[b.file], lb)
+	}
+
+	for _, fileBlocks := range byFile {
+		sort.SliceStable(fileBlocks, func(i, j int) bool {
+			a, b := fileBlocks[i].block, fileBlocks[j].block
+			if a.startLine != b.startLine {
+				return a.startLine < b.startLine
+			}
+			return a.startCol < b.startCol
+		})
+		// Compare each block with the earlier block that ends furthest on,
+		// so that every block inside a long block is found
+		furthest := fileBlocks[0]
+		for _, lb := range fileBlocks[1:] {
+			if posBefore(lb.block.startLine, lb.block.startCol,
+				furthest.block.endLine, furthest.block.endCol) {
+				line, other := lb.line, furthest.line
+				if line < other {
+					line, other = other, line
+				}
+				errs = append(errs, validationError{line: line,
+					msg: fmt.Sprintf("overlaps block on line %d", other),
+				})
+			}
+			if posBefore(furthest.block.endLine, furthest.block.endCol,
+				lb.block.endLine, lb.block.endCol) {
+				furthest = lb
+			}
+		}
+	}
+	return errs
+}
+
+// posBefore returns true if line a, column b is before line c, column d
+func posBefore(a, b, c, d int) bool {
+	return a < c || (a == c && b < d)
+}
+
+// checkBlockSources reports blocks whose source file can't be found or
+// whose positions are outside of the source file
+func checkBlockSources(
+	blocks []lineBlock,
+	resolver *pathResolver,
+) []validationError {
+	errs := []validationError{}
+	sources := map[string][]string{}
+	sourceErrs := map[string]error{}
+	for _, lb := range blocks {
+		b := lb.block
+		lines, ok := sources[b.file]
+		if !ok && sourceErrs[b.file] == nil {
+			var err error
+			lines, err = readSourceLines(resolver, b.file)
+			if err != nil {
+				sourceErrs[b.file] = err
+			} else {
+				sources[b.file] = lines
+			}
+		}
+		if err := sourceErrs[b.file]; err != nil {
+			errs = append(errs, validationError{line: lb.line, msg: err.Error()})
+			continue
+		}
+		if !posInSource(lines, b.startLine, b.startCol) {
+			errs = append(errs, validationError{line: lb.line,
+				msg: fmt.Sprintf("block start %d.%d is outside of source file",
+					b.startLine, b.startCol),
+			})
+		}
+		if !posInSource(lines, b.endLine, b.endCol) {
+			errs = append(errs, validationError{line: lb.line,
+				msg: fmt.Sprintf("block end %d.%d is outside of source file",
+					b.endLine, b.endCol),
+			})
+		}
+	}
+	return errs
+}
+
+// posInSource returns true if line and col, which start at 1, are within
+// lines.  col may be one past the end of the line.
+func posInSource(lines []string, line int, col int) bool {
+	if line > len(lines) {
+		return false
+	}
+	return col <= len(lines[line-1])+1
+}
+
+// readSourceLines returns the lines of the source file for file from a
+// coverage profile
+func readSourceLines(resolver *pathResolver, file string) ([]string, error) {
+	filename, err := resolver.resolve(file)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
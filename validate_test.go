@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateProfile(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := filepath.Join(wd, "fixtures", "good", "good.go")
+	cases := []struct {
+		in          string
+		checkSource bool
+		want        []validationError
+	}{
+		{in: "mode: count\n" +
+			"example.com/a/a.go:3.20,5.2 1 2\n" +
+			"example.com/a/a.go:6.2,7.2 1 0\n",
+			want: []validationError{},
+		},
+		{in: "example.com/a/a.go:3.20,5.2 1 2\n",
+			want: []validationError{{line: 1, msg: "missing mode line"}},
+		},
+		{in: "mode: often\n",
+			want: []validationError{{line: 1, msg: "invalid mode: often"}},
+		},
+		{in: "", want: []validationError{{line: 1, msg: "empty profile"}}},
+		{in: "mode: set\n" +
+			"example.com/a/a.go:3.20,5.2 1 2\n" +
+			"mode: set\n" +
+			"example.com/a/a.go:3.20\n" +
+			"example.com/a/a.go:9.20,8.2 1 0\n",
+			want: []validationError{
+				{line: 2, msg: "count greater than 1 in set mode: example.com/a/a.go:3.20,5.2 1 2"},
+				{line: 3, msg: "unexpected mode line"},
+				{line: 4, msg: "invalid block: example.com/a/a.go:3.20"},
+				{line: 5, msg: "block ends before it starts: example.com/a/a.go:9.20,8.2 1 0"},
+			},
+		},
+		{in: "mode: count\n" +
+			"example.com/a/a.go:3.20,5.2 1 2\n" +
+			"example.com/a/a.go:3.20,5.2 1 1\n" +
+			"example.com/a/a.go:3.20,5.2 2 1\n" +
+			"example.com/a/a.go:4.2,6.2 1 1\n",
+			want: []validationError{
+				{line: 3, msg: "duplicate of block on line 2"},
+				{line: 4, msg: "inconsistent number of statements with duplicate block on line 2"},
+				{line: 5, msg: "overlaps block on line 2"},
+			},
+		},
+		{in: "mode: count\n" +
+			"example.com/a/a.go:1.1,100.2 1 1\n" +
+			"example.com/a/a.go:5.1,6.2 1 1\n" +
+			"example.com/a/a.go:10.1,11.2 1 1\n",
+			want: []validationError{
+				{line: 3, msg: "overlaps block on line 2"},
+				{line: 4, msg: "overlaps block on line 2"},
+			},
+		},
+		{in: "mode: count\n" +
+			good + ":4.21,6.2 1 1\n" +
+			good + ":4.21,7.2 1 1\n" +
+			good + ":1.1,1.40 1 1\n" +
+			"example.com/nonexistant/a.go:1.1,1.2 1 1\n",
+			checkSource: true,
+			want: []validationError{
+				{line: 3, msg: "overlaps block on line 2"},
+				{line: 3, msg: "block end 7.2 is outside of source file"},
+				{line: 4, msg: "block end 1.40 is outside of source file"},
+				{line: 5, msg: "can't find source file for: example.com/nonexistant/a.go"},
+			},
+		},
+	}
+	for i, c := range cases {
+		got, err := validateProfile(strings.NewReader(c.in), newPathResolver(),
+			c.checkSource)
+		if err != nil {
+			t.Errorf("(%d) validateProfile err: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("(%d) validateProfile got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
+
+func TestRun_validate(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir, err := ioutil.TempDir("", "roveralls_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	good := filepath.Join(wd, "fixtures", "good", "good.go")
+	validFilename := filepath.Join(tmpDir, "valid.out")
+	invalidFilename := filepath.Join(tmpDir, "invalid.out")
+	err = ioutil.WriteFile(validFilename,
+		[]byte("mode: set\n"+good+":4.21,6.2 1 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(invalidFilename,
+		[]byte("mode: set\n"+good+":4.21,6.2 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		cmdArgs      []string
+		wantExitCode int
+		wantOut      string
+		wantErr      string
+	}{
+		{cmdArgs: []string{"validate", validFilename},
+			wantOut: validFilename + ": valid\n",
+		},
+		{cmdArgs: []string{"validate", validFilename, invalidFilename},
+			wantExitCode: 1,
+			wantOut:      validFilename + ": valid\n",
+			wantErr:      invalidFilename + ":2: invalid block: " + good + ":4.21,6.2 1\n",
+		},
+	}
+	for _, c := range cases {
+		var gotOut bytes.Buffer
+		var gotErr bytes.Buffer
+		cmdArgs := append([]string{os.Args[0]}, c.cmdArgs...)
+		initProgram(cmdArgs, &gotOut, &gotErr, os.Getenv("GOPATH"))
+		exitCode := program.Run()
+		if exitCode != c.wantExitCode {
+			t.Errorf("Run(%s): incorrect exit code, got: %d, want: %d",
+				c.cmdArgs, exitCode, c.wantExitCode)
+		}
+		if gotErr.String() != c.wantErr {
+			t.Errorf("Run(%s): gotErr: %s, wantErr: %s",
+				c.cmdArgs, gotErr.String(), c.wantErr)
+		}
+		if gotOut.String() != c.wantOut {
+			t.Errorf("Run(%s): gotOut: %s, wantOut: %s",
+				c.cmdArgs, gotOut.String(), c.wantOut)
+		}
+	}
+}